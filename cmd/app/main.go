@@ -2,114 +2,393 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/segmentio/kafka-go"
+	"github.com/tmozzze/order_checker/database/migrations"
+	"github.com/tmozzze/order_checker/internal/anomaly"
 	"github.com/tmozzze/order_checker/internal/api"
 	"github.com/tmozzze/order_checker/internal/cache"
 	"github.com/tmozzze/order_checker/internal/config"
 	"github.com/tmozzze/order_checker/internal/db"
+	"github.com/tmozzze/order_checker/internal/events"
+	"github.com/tmozzze/order_checker/internal/health"
 	"github.com/tmozzze/order_checker/internal/kafka_consumer"
+	"github.com/tmozzze/order_checker/internal/logging"
+	"github.com/tmozzze/order_checker/internal/metrics"
+	"github.com/tmozzze/order_checker/internal/migrate"
+	"github.com/tmozzze/order_checker/internal/outbox"
 	"github.com/tmozzze/order_checker/internal/repository"
 	"github.com/tmozzze/order_checker/internal/service"
+	"github.com/tmozzze/order_checker/internal/stream"
+	"github.com/tmozzze/order_checker/internal/tracing"
+	"github.com/tmozzze/order_checker/internal/validation"
+	"github.com/tmozzze/order_checker/internal/warmup"
+	"github.com/tmozzze/order_checker/internal/webhook"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	// Config
-	cfg, err := config.Load()
+	cfg, err := config.Load(os.Args[1:])
+	// Printed even when invalid, that's when it helps the most
+	if cfg != nil && cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal(slog.Default(), "failed to print config", err)
+		}
+	}
 	if err != nil {
-		log.Fatal("Config error:", err)
+		fatal(slog.Default(), "config error", err)
+	}
+	if cfg.PrintConfig {
+		return
 	}
 
-	ctx := context.Background()
+	// Logger, the level can be changed at runtime via /admin/log-level
+	logger, logLevel, err := logging.New(os.Stdout, logging.Config{
+		Level:  cfg.Log.Level,
+		Format: cfg.Log.Format,
+	})
+	if err != nil {
+		fatal(slog.Default(), "logger init failed", err)
+	}
+	// Libraries still writing through the log package end up here too
+	slog.SetDefault(logger)
+
+	// Validation profiles, a broken file stops the start
+	profiles, err := validation.LoadProfiles(cfg.Validation.ProfilesFile)
+	if err != nil {
+		fatal(logger, "failed to load validation profiles", err)
+	}
+
+	// Cancelled on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Tracing
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:     cfg.Tracing.Exporter,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		OTLPInsecure: cfg.Tracing.OTLPInsecure,
+		File:         cfg.Tracing.File,
+		ServiceName:  cfg.Tracing.ServiceName,
+		SampleRatio:  cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		fatal(logger, "tracing init failed", err)
+	}
 
 	// Postgres
 	database, err := db.NewDB(ctx, cfg)
 	if err != nil {
-		log.Fatal("Postgres init failed:", err)
+		fatal(logger, "postgres init failed", err)
 	}
-	defer database.Pool.Close()
 
-	log.Println("Connected to Postgres on port", cfg.DBPort)
+	logger.Info("connected to postgres", "host", cfg.DB.Host, "port", cfg.DB.Port)
+
+	// Schema, instances starting together take turns on the migration lock
+	if cfg.DB.AutoMigrate {
+		migrator, err := migrate.New(database.Pool, migrations.FS, logger)
+		if err != nil {
+			fatal(logger, "failed to load migrations", err)
+		}
+		if _, err := migrator.Up(ctx); err != nil {
+			fatal(logger, "migrations failed", err)
+		}
+	}
 
-	// Repositories and cache(capacity: 100)
+	// Repositories and cache
 	repo := repository.NewOrderRepository(database.Pool)
+	submissions := repository.NewSubmissionRepository(database.Pool)
 
-	log.Println("Start preloading data in cache...")
-	c := cache.New(100)
+	c := cache.New(cfg.Cache.Capacity)
+
+	// Event bus: the consumer and the cache publish order lifecycle events
+	bus := events.NewBus()
+	c.OnEvict(func(key string, _ interface{}) {
+		bus.Publish(ctx, events.Event{Type: events.CacheEvicted, OrderUID: key})
+	})
+
+	// Cache warm-up in background
+	warmer := warmup.New(repo, c, cfg.Cache.WarmupBatch, cfg.Cache.WarmupTimeout, logger)
+	warmer.Start(ctx)
 
 	// Kafka
-	broker := "localhost:9092"
-	topic := "orders"
+	brokers := cfg.Kafka.Brokers
+	topic := cfg.Kafka.Topic
 
-	if err := kafka_consumer.EnsureTopic(broker, topic, 1, 1); err != nil {
-		log.Fatal("failed to ensure topic:", err)
+	for _, t := range []string{topic, cfg.Kafka.DLQTopic, cfg.Kafka.StatusTopic, cfg.Kafka.StatusDLQTopic} {
+		if err := kafka_consumer.EnsureTopic(brokers[0], t, cfg.Kafka.Partitions, cfg.Kafka.ReplicationFactor, logger); err != nil {
+			fatal(logger, "failed to ensure topic", err)
+		}
 	}
 
-	processedC := make(chan string)
+	// Dead-letter queues, one per source topic so redrive goes back to it
+	dlq := kafka_consumer.NewDeadLetterQueue(brokers, cfg.Kafka.DLQTopic, topic)
+	statusDLQ := kafka_consumer.NewDeadLetterQueue(brokers, cfg.Kafka.StatusDLQTopic, cfg.Kafka.StatusTopic)
 
-	// Producer | Writer
-	writer := kafka.NewWriter(kafka.WriterConfig{
-		Brokers: []string{broker},
-		Topic:   topic,
-	})
-	defer writer.Close()
+	// Producer | Writer, keyed by order_uid. Topic is set per message
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+
+	// Outbox relay in background. Workers get their own contexts so they
+	// can be stopped one by one on shutdown
+	outboxRepo := repository.NewOutboxRepository(database.Pool)
+	relay := outbox.NewRelay(outboxRepo, writer, cfg.Outbox.PollInterval, cfg.Outbox.BatchSize, cfg.Outbox.MaxAttempts, logger)
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		relay.Run(relayCtx)
+	}()
+
+	// Webhooks: the dispatcher stores deliveries for bus events and ends
+	// with the bus, the sender posts them
+	webhookRepo := repository.NewWebhookRepository(database.Pool)
+	dispatcher := webhook.NewDispatcher(webhookRepo, bus, logger)
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+		dispatcher.Run(context.Background())
+	}()
+	sender := webhook.NewSender(webhookRepo, webhook.Config{
+		PollInterval: cfg.Webhooks.PollInterval,
+		BatchSize:    cfg.Webhooks.BatchSize,
+		MaxAttempts:  cfg.Webhooks.MaxAttempts,
+		Timeout:      cfg.Webhooks.Timeout,
+		RetryInitial: cfg.Webhooks.RetryInitial,
+		RetryMax:     cfg.Webhooks.RetryMax,
+	}, logger)
+	senderCtx, stopSender := context.WithCancel(context.Background())
+	senderDone := make(chan struct{})
+	go func() {
+		defer close(senderDone)
+		sender.Run(senderCtx)
+	}()
+
+	// Anomaly checker scores persisted orders, ends with the bus like the dispatcher
+	findingRepo := repository.NewFindingRepository(database.Pool)
+	anomalies := anomaly.NewChecker(repo, findingRepo, bus, anomaly.Config{
+		MaxSale:                cfg.Anomaly.MaxSale,
+		MaxPaymentSkew:         cfg.Anomaly.MaxPaymentSkew,
+		MaxDeliveryRatio:       cfg.Anomaly.MaxDeliveryRatio,
+		MaxCustomersPerContact: cfg.Anomaly.MaxCustomersPerContact,
+		BackfillInterval:       cfg.Anomaly.BackfillInterval,
+	}, logger)
+	anomaliesDone := make(chan struct{})
+	go func() {
+		defer close(anomaliesDone)
+		anomalies.Run(context.Background())
+	}()
 
 	// Consumer
+	retryPolicy := kafka_consumer.RetryPolicy{
+		InitialInterval: cfg.Kafka.Retry.InitialInterval,
+		MaxInterval:     cfg.Kafka.Retry.MaxInterval,
+		Multiplier:      cfg.Kafka.Retry.Multiplier,
+		MaxAttempts:     cfg.Kafka.Retry.MaxAttempts,
+		AttemptTimeout:  cfg.Kafka.Retry.AttemptTimeout,
+	}
 	consumer := kafka_consumer.NewConsumer(
-		[]string{broker},
+		brokers,
 		topic,
-		"test-group",
+		cfg.Kafka.GroupID,
 		repo,
+		submissions,
 		c,
-		processedC,
+		dlq,
+		profiles,
+		retryPolicy,
+		bus,
+		logger,
 	)
 	// Consumer in background
+	consumerCtx, stopConsumer := context.WithCancel(context.Background())
+	consumerDone := make(chan struct{})
 	go func() {
-		log.Println("Starting kafka consumer...")
-		if err := consumer.Start(ctx); err != nil {
-			log.Fatal("consumer failed:", err)
+		defer close(consumerDone)
+		if err := consumer.Start(consumerCtx); err != nil {
+			logger.Error("consumer failed", "error", err)
+			stop()
 		}
 	}()
 
 	// Service + Handlers
-	svc := service.NewOrderService(repo, c, writer)
-	h := api.NewOrderHandler(svc)
+	svc := service.NewOrderService(repo, c, submissions, topic, cfg.Location(), logger)
+
+	// Status updates from other services, on their own topic and group
+	statusConsumer := kafka_consumer.NewStatusConsumer(brokers, cfg.Kafka.StatusTopic, cfg.Kafka.StatusGroupID, svc, statusDLQ, retryPolicy, logger)
+	statusCtx, stopStatus := context.WithCancel(context.Background())
+	statusDone := make(chan struct{})
+	go func() {
+		defer close(statusDone)
+		if err := statusConsumer.Start(statusCtx); err != nil {
+			logger.Error("status consumer failed", "error", err)
+			stop()
+		}
+	}()
+
+	h := api.NewOrderHandler(svc, profiles, topic, logger)
+	dlqHandler := api.NewDLQHandler(dlq, logger)
+	statusDLQHandler := api.NewDLQHandler(statusDLQ, logger)
+	adminHandler := api.NewAdminHandler(outboxRepo, logLevel, logger)
+	webhookHandler := api.NewWebhookHandler(webhookRepo, logger)
+	findingHandler := api.NewFindingHandler(anomalies, logger)
+
+	// Live feed for SSE and WebSocket clients
+	hub := stream.NewHub(bus, cfg.Stream.ReplaySize, cfg.Stream.ClientBuffer, logger)
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	go hub.Run(hubCtx)
+	streamHandler := api.NewStreamHandler(hub, cfg.Stream.Heartbeat, logger)
+
+	// Health checks for /readyz
+	checker := health.NewChecker(cfg.Health.CheckTimeout)
+	checker.Add("postgres", database.Pool.Ping)
+	checker.Add("kafka", func(ctx context.Context) error {
+		return kafka_consumer.PingBrokers(ctx, brokers)
+	})
+	checker.Add("consumer", func(ctx context.Context) error {
+		return consumer.CheckHealth(ctx, cfg.Kafka.MaxLag)
+	})
+	checker.Add("cache_warmup", warmer.Check)
+	healthHandler := api.NewHealthHandler(checker)
+
+	// Metrics
+	registry := prometheus.NewRegistry()
+	if err := metrics.Register(registry); err != nil {
+		fatal(logger, "failed to register metrics", err)
+	}
+	registry.MustRegister(metrics.NewCacheCollector(c), metrics.NewPoolCollector(database.Pool))
 
 	// Router
 	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Use(logging.Middleware(logger))
+	r.Use(metrics.Middleware)
+	r.Handle("/metrics", metrics.Handler(registry))
 
 	// Frontend
-	fs := http.FileServer(http.Dir("./web"))
+	fs := http.FileServer(http.Dir(cfg.HTTP.StaticDir))
 	r.Handle("/*", fs)
 
 	// API
 	h.RegisterRoutes(r)
+	streamHandler.RegisterRoutes(r)
+	dlqHandler.RegisterRoutes(r)
+	r.Route("/status", statusDLQHandler.RegisterRoutes)
+	adminHandler.RegisterRoutes(r)
+	webhookHandler.RegisterRoutes(r)
+	findingHandler.RegisterRoutes(r)
+	healthHandler.RegisterRoutes(r)
 
-	// Start HTTP Server on :8080
+	// Start HTTP Server
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.HTTP.Addr,
 		Handler: r,
 	}
+	// Streams never finish on their own, end them so Shutdown can drain
+	srv.RegisterOnShutdown(stopHub)
 
-	log.Println("Starting HTTP server...")
 	go func() {
-		log.Println("HTTP server started on :8080")
+		logger.Info("HTTP server started", "addr", cfg.HTTP.Addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal("server failed:", err)
+			logger.Error("server failed", "error", err)
+			stop()
 		}
 	}()
 
-	// Logs orders from consumer
+	// Logs order events, drops them rather than slowing the consumer
+	eventLog := bus.Subscribe("log", 256, events.Drop)
 	go func() {
-		for orderUID := range processedC {
-			log.Printf("Order proccesed: %s", orderUID)
+		for {
+			select {
+			case e := <-eventLog.Events():
+				logger.Debug("order event", "event_id", e.ID, "type", e.Type,
+					slog.String(logging.KeyOrderUID, e.OrderUID))
+			case <-eventLog.Done():
+				return
+			}
 		}
 	}()
 
-	select {} // Wait forever
+	<-ctx.Done()
+	stop()
+
+	// Shutdown order: HTTP -> consumer -> relay, webhooks -> Kafka writers -> Postgres,
+	// so nothing is still writing into a component that is already closed
+	logger.Info("shutdown started", "deadline", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Fail readiness first so load balancers stop sending traffic
+	checker.SetShuttingDown()
+
+	logger.Info("shutdown 1/5: stopping HTTP server")
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("HTTP server shutdown", "error", err)
+	}
+
+	logger.Info("shutdown 2/5: stopping kafka consumers")
+	stopConsumer()
+	stopStatus()
+	waitDone(shutdownCtx, logger, consumerDone, "kafka consumer")
+	waitDone(shutdownCtx, logger, statusDone, "status consumer")
+	bus.Close()
+	waitDone(shutdownCtx, logger, dispatcherDone, "webhook dispatcher")
+	waitDone(shutdownCtx, logger, anomaliesDone, "anomaly checker")
+
+	logger.Info("shutdown 3/5: stopping outbox relay and webhook sender")
+	stopRelay()
+	stopSender()
+	waitDone(shutdownCtx, logger, relayDone, "outbox relay")
+	waitDone(shutdownCtx, logger, senderDone, "webhook sender")
+
+	logger.Info("shutdown 4/5: flushing kafka writers")
+	if err := writer.Close(); err != nil {
+		logger.Error("kafka writer close", "error", err)
+	}
+	if err := dlq.Close(); err != nil {
+		logger.Error("DLQ writer close", "error", err)
+	}
+	if err := statusDLQ.Close(); err != nil {
+		logger.Error("status DLQ writer close", "error", err)
+	}
+
+	logger.Info("shutdown 5/5: closing postgres pool")
+	database.Pool.Close()
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("tracing shutdown", "error", err)
+	}
+
+	logger.Info("shutdown complete")
+}
+
+// waitDone waits for a background worker or gives up at the deadline
+func waitDone(ctx context.Context, logger *slog.Logger, done <-chan struct{}, name string) {
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Warn("did not stop before shutdown deadline", "component", name)
+	}
+}
+
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 /*
@@ -132,11 +411,11 @@ curl -X POST http://localhost:8080/orders \
       "transaction": "trx-778",
       "currency": "USD",
       "provider": "visa",
-      "amount": 100,
+      "amount": 110,
       "payment_dt": 1637907727,
       "bank": "alpha",
       "delivery_cost": 10,
-      "goods_total": 90
+      "goods_total": 100
     },
     "items": [
       {
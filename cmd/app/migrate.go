@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/tmozzze/order_checker/database/migrations"
+	"github.com/tmozzze/order_checker/internal/config"
+	"github.com/tmozzze/order_checker/internal/db"
+	"github.com/tmozzze/order_checker/internal/logging"
+	"github.com/tmozzze/order_checker/internal/migrate"
+)
+
+const migrateUsage = "usage: app migrate up|down [n]|status [config flags]"
+
+// runMigrate handles `app migrate ...` and exits
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+	action, args := args[0], args[1:]
+
+	// down takes an optional step count before the config flags
+	steps := 1
+	if action == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			steps, args = n, args[1:]
+		}
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		fatal(slog.Default(), "config error", err)
+	}
+	logger, _, err := logging.New(os.Stderr, logging.Config{Level: cfg.Log.Level, Format: cfg.Log.Format})
+	if err != nil {
+		fatal(slog.Default(), "logger init failed", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	database, err := db.NewDB(ctx, cfg)
+	if err != nil {
+		fatal(logger, "postgres init failed", err)
+	}
+	defer database.Pool.Close()
+
+	m, err := migrate.New(database.Pool, migrations.FS, logger)
+	if err != nil {
+		fatal(logger, "failed to load migrations", err)
+	}
+
+	switch action {
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			fatal(logger, "migrate up failed", err)
+		}
+		logger.Info("migrations applied", "count", n)
+	case "down":
+		n, err := m.Down(ctx, steps)
+		if err != nil {
+			fatal(logger, "migrate down failed", err)
+		}
+		logger.Info("migrations rolled back", "count", n)
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			fatal(logger, "migrate status failed", err)
+		}
+		printMigrationStatus(status)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
+
+func printMigrationStatus(status []migrate.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, s := range status {
+		state, at := "pending", ""
+		if s.Applied {
+			state, at = "applied", s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+		}
+		switch {
+		case !s.Known:
+			state += ", unknown to this binary"
+		case s.Modified:
+			state += ", modified since applied"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, at)
+	}
+	w.Flush()
+}
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS order_events;
+DROP TABLE IF EXISTS order_status_changes;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
+DROP TABLE IF EXISTS submissions;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS deliveries;
+DROP TABLE IF EXISTS orders;
+DROP FUNCTION IF EXISTS order_events_append_only();
@@ -0,0 +1,177 @@
+-- Baseline: the schema formerly created by database/init.sql. Written so it
+-- also applies on top of a database initialised by that script
+
+CREATE TABLE IF NOT EXISTS orders (
+    order_uid TEXT PRIMARY KEY NOT NULL,
+    track_number TEXT,
+    entry TEXT,
+    locale TEXT,
+    internal_signature TEXT,
+    customer_id TEXT NOT NULL,
+    delivery_service TEXT,
+    shardkey TEXT,
+    sm_id INT,
+    date_created TIMESTAMP NOT NULL DEFAULT now(),
+    oof_shard TEXT,
+    payload_hash TEXT,
+    status TEXT NOT NULL DEFAULT 'created'
+);
+
+-- init.sql created orders without these, CREATE TABLE IF NOT EXISTS keeps
+-- that table as it is
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS payload_hash TEXT,
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'created';
+
+CREATE TABLE IF NOT EXISTS deliveries (
+    id SERIAL PRIMARY KEY,
+    order_uid TEXT REFERENCES orders(order_uid),
+    name TEXT,
+    phone TEXT,
+    zip TEXT,
+    city TEXT,
+    address TEXT,
+    region TEXT,
+    email TEXT
+);
+
+CREATE TABLE IF NOT EXISTS payments (
+    id SERIAL PRIMARY KEY,
+    order_uid TEXT REFERENCES orders(order_uid),
+    transaction TEXT,
+    request_id TEXT,
+    currency TEXT,
+    provider TEXT,
+    amount INT,
+    payment_dt BIGINT,
+    bank TEXT,
+    delivery_cost INT,
+    goods_total INT,
+    custom_fee INT
+);
+
+CREATE TABLE IF NOT EXISTS items (
+    id SERIAL PRIMARY KEY,
+    order_uid TEXT REFERENCES orders(order_uid),
+    chrt_id INT,
+    track_number TEXT,
+    price INT,
+    rid TEXT,
+    name TEXT,
+    sale INT,
+    size TEXT,
+    total_price INT,
+    nm_id INT,
+    brand TEXT,
+    status INT
+);
+
+-- Indexes for GET /orders filters and keyset pagination
+CREATE INDEX IF NOT EXISTS idx_orders_date_created ON orders (date_created DESC, order_uid DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders (customer_id, date_created DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_track_number ON orders (track_number);
+CREATE INDEX IF NOT EXISTS idx_payments_provider ON payments (provider, order_uid);
+CREATE INDEX IF NOT EXISTS idx_payments_currency ON payments (currency, order_uid);
+CREATE INDEX IF NOT EXISTS idx_deliveries_city ON deliveries (city, order_uid);
+CREATE INDEX IF NOT EXISTS idx_items_brand ON items (brand, order_uid);
+
+-- Transactional outbox for POST /orders, published to Kafka by the relay
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid TEXT NOT NULL,
+    topic TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    headers JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (order_uid, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_outbox_status ON outbox (status, created_at);
+
+-- Status of orders submitted through POST /orders
+CREATE TABLE IF NOT EXISTS submissions (
+    id TEXT PRIMARY KEY,
+    order_uid TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Webhook subscriptions, event_types empty means every event
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- One row per event and subscription, doubles as delivery history
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    order_uid TEXT NOT NULL DEFAULT '',
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    response_status INT,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription ON webhook_deliveries (subscription_id, id DESC);
+
+-- Applied order status transitions, see models.OrderStatus
+CREATE TABLE IF NOT EXISTS order_status_changes (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid TEXT NOT NULL REFERENCES orders(order_uid),
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_changes_order ON order_status_changes (order_uid, id);
+
+-- Append-only history of every order, see models.OrderEvent. No foreign
+-- key so the history outlives the order
+CREATE TABLE IF NOT EXISTS order_events (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid TEXT NOT NULL,
+    type TEXT NOT NULL,
+    source TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    submission_id TEXT NOT NULL DEFAULT '',
+    kafka_topic TEXT NOT NULL DEFAULT '',
+    kafka_partition INT,
+    kafka_offset BIGINT,
+    payload_hash TEXT NOT NULL DEFAULT '',
+    diff JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_events_order ON order_events (order_uid, id);
+
+CREATE OR REPLACE FUNCTION order_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'order_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER order_events_append_only
+    BEFORE UPDATE OR DELETE ON order_events
+    FOR EACH ROW EXECUTE FUNCTION order_events_append_only();
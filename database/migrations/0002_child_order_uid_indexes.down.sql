@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_deliveries_order_uid;
+DROP INDEX IF EXISTS idx_payments_order_uid;
+DROP INDEX IF EXISTS idx_items_order_uid;
@@ -0,0 +1,4 @@
+-- Order lookups read every child table by order_uid
+CREATE INDEX idx_deliveries_order_uid ON deliveries (order_uid);
+CREATE INDEX idx_payments_order_uid ON payments (order_uid);
+CREATE INDEX idx_items_order_uid ON items (order_uid);
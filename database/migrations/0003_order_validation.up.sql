@@ -0,0 +1,2 @@
+-- Validation profile and the violations it let through as warnings
+ALTER TABLE orders ADD COLUMN validation JSONB;
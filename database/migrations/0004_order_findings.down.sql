@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_deliveries_email;
+DROP INDEX IF EXISTS idx_deliveries_phone;
+DROP INDEX IF EXISTS idx_payments_transaction;
+DROP TABLE IF EXISTS order_findings;
@@ -0,0 +1,20 @@
+-- Suspicious patterns found by the anomaly checker, see models.Finding.
+-- A re-check replaces the findings of the order
+CREATE TABLE order_findings (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid TEXT NOT NULL REFERENCES orders(order_uid),
+    rule TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    message TEXT NOT NULL,
+    details JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_order_findings_order ON order_findings (order_uid, id);
+CREATE INDEX idx_order_findings_created ON order_findings (id DESC);
+CREATE INDEX idx_order_findings_severity ON order_findings (severity, id DESC);
+
+-- Lookups of the rules that compare orders
+CREATE INDEX idx_payments_transaction ON payments (transaction);
+CREATE INDEX idx_deliveries_phone ON deliveries (phone) WHERE phone <> '';
+CREATE INDEX idx_deliveries_email ON deliveries (email) WHERE email <> '';
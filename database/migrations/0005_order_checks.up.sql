@@ -0,0 +1,6 @@
+-- Orders the anomaly checker has checked, clean ones included. Orders
+-- without a row are checked by the backfill on start
+CREATE TABLE order_checks (
+    order_uid TEXT PRIMARY KEY REFERENCES orders(order_uid),
+    checked_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
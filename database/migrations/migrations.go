@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL schema migrations, applied by
+// internal/migrate. Files are NNNN_name.up.sql with a matching
+// NNNN_name.down.sql, applied migrations must never be edited
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
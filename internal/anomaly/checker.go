@@ -0,0 +1,304 @@
+package anomaly
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/events"
+	"github.com/tmozzze/order_checker/internal/logging"
+	"github.com/tmozzze/order_checker/internal/metrics"
+	"github.com/tmozzze/order_checker/internal/models"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+// Checker checks every persisted order and keeps its findings
+type Checker struct {
+	orders   repository.OrderStore
+	findings *repository.FindingRepository
+	bus      *events.Bus
+	cfg      Config
+	log      *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]struct{} // orders whose related orders need a re-check
+	wake    chan struct{}
+}
+
+func NewChecker(orders repository.OrderStore, findings *repository.FindingRepository, bus *events.Bus, cfg Config, logger *slog.Logger) *Checker {
+	return &Checker{
+		orders:   orders,
+		findings: findings,
+		bus:      bus,
+		cfg:      cfg,
+		log:      logger.With("component", "anomaly_checker"),
+		pending:  make(map[string]struct{}),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Orders per page of the backfill
+const backfillBatch = 100
+
+// Run checks orders as they are persisted until ctx is cancelled or the
+// bus is closed. Related orders are re-checked and stored orders never
+// checked are backfilled in the background
+func (c *Checker) Run(ctx context.Context) {
+	// Drop: the consumer never waits for checks, the backfill picks up
+	// the orders whose events were dropped
+	sub := c.bus.Subscribe("anomaly", 256, events.Drop, events.OrderPersisted)
+	defer sub.Close()
+
+	bgCtx, stop := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.runBackfill(bgCtx)
+	}()
+	go func() {
+		defer wg.Done()
+		c.runRelated(bgCtx)
+	}()
+	defer func() {
+		stop()
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case e := <-sub.Events():
+			c.handle(ctx, e)
+		case <-sub.Done():
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Checker) handle(ctx context.Context, e events.Event) {
+	ctx = logging.With(ctx, slog.String(logging.KeyOrderUID, e.OrderUID))
+	if _, err := c.check(ctx, e.OrderUID, e.Order); err != nil {
+		c.log.ErrorContext(ctx, "anomaly check failed", "error", err)
+		return
+	}
+	c.queueRelated(e.OrderUID)
+}
+
+// runBackfill backfills at start and then every cfg.BackfillInterval
+func (c *Checker) runBackfill(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.BackfillInterval)
+	defer ticker.Stop()
+	for {
+		c.backfill(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// backfill checks the stored orders the checker has not seen: the ones
+// stored before it existed or whose events were dropped
+func (c *Checker) backfill(ctx context.Context) {
+	var checked, failed int
+	after := ""
+	for ctx.Err() == nil {
+		uids, err := c.findings.UncheckedOrders(ctx, after, backfillBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.log.ErrorContext(ctx, "anomaly backfill stopped", "checked", checked, "error", err)
+			}
+			return
+		}
+		for _, uid := range uids {
+			if _, err := c.check(ctx, uid, nil); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				failed++
+				c.log.WarnContext(ctx, "anomaly backfill check failed", slog.String(logging.KeyOrderUID, uid), "error", err)
+				continue
+			}
+			checked++
+		}
+		if len(uids) < backfillBatch {
+			break
+		}
+		after = uids[len(uids)-1]
+	}
+	if checked > 0 || failed > 0 {
+		c.log.InfoContext(ctx, "anomaly backfill done", "checked", checked, "failed", failed)
+	}
+}
+
+// Check checks a stored order again and replaces its findings. Its related
+// orders are re-checked in the background
+func (c *Checker) Check(ctx context.Context, orderUID string) (*models.OrderFindings, error) {
+	result, err := c.check(ctx, orderUID, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.queueRelated(orderUID)
+	return result, nil
+}
+
+// queueRelated asks runRelated to re-check the orders orderUID shares a
+// transaction or a contact with: their findings depend on this one. An
+// order already queued is queued once
+func (c *Checker) queueRelated(orderUID string) {
+	c.mu.Lock()
+	c.pending[orderUID] = struct{}{}
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextRelated takes an order off the queue, false if it is empty
+func (c *Checker) nextRelated() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for uid := range c.pending {
+		delete(c.pending, uid)
+		return uid, true
+	}
+	return "", false
+}
+
+// runRelated drains the queue filled by queueRelated until ctx is done
+func (c *Checker) runRelated(ctx context.Context) {
+	for {
+		select {
+		case <-c.wake:
+		case <-ctx.Done():
+			return
+		}
+		for ctx.Err() == nil {
+			uid, ok := c.nextRelated()
+			if !ok {
+				break
+			}
+			c.recheckRelated(logging.With(ctx, slog.String(logging.KeyOrderUID, uid)), uid)
+		}
+	}
+}
+
+func (c *Checker) recheckRelated(ctx context.Context, orderUID string) {
+	o, err := c.orders.GetOrderById(ctx, orderUID)
+	if err != nil {
+		c.log.WarnContext(ctx, "failed to load order for related checks", "error", err)
+		return
+	}
+	findings, err := c.findings.ListOrderFindings(ctx, orderUID)
+	if err != nil {
+		c.log.WarnContext(ctx, "failed to load findings for related checks", "error", err)
+		return
+	}
+	related, err := c.related(ctx, o, findings)
+	if err != nil {
+		c.log.WarnContext(ctx, "failed to find related orders", "error", err)
+	}
+	for _, uid := range related {
+		if _, err := c.check(ctx, uid, nil); err != nil && ctx.Err() == nil {
+			c.log.WarnContext(ctx, "related order check failed", "related", uid, "error", err)
+		}
+	}
+}
+
+// related lists the other orders behind the cross-order findings of o
+func (c *Checker) related(ctx context.Context, o *models.Order, findings []models.Finding) ([]string, error) {
+	var uids []string
+	for _, f := range findings {
+		var (
+			list []string
+			err  error
+		)
+		switch f.Rule {
+		case RuleTransactionReused:
+			list, err = c.findings.OrdersWithTransaction(ctx, o.Payment.Transaction, o.OrderUID)
+		case RuleContactShared:
+			list, err = c.findings.OrdersWithContact(ctx, o.Delivery.Phone, o.Delivery.Email, o.OrderUID)
+		default:
+			continue
+		}
+		if err != nil {
+			return uids, err
+		}
+		for _, uid := range list {
+			if !slices.Contains(uids, uid) {
+				uids = append(uids, uid)
+			}
+		}
+	}
+	return uids, nil
+}
+
+func (c *Checker) check(ctx context.Context, orderUID string, o *models.Order) (*models.OrderFindings, error) {
+	if o == nil {
+		var err error
+		if o, err = c.orders.GetOrderById(ctx, orderUID); err != nil {
+			return nil, err
+		}
+	}
+
+	findings, err := Evaluate(ctx, o, c.findings, c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	checkedAt, added, err := c.findings.ReplaceFindings(ctx, orderUID, findings)
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-checks find the same again, only new findings are counted
+	for _, f := range added {
+		metrics.OrderFindings.WithLabelValues(f.Rule, string(f.Severity)).Inc()
+	}
+	score := models.Score(findings)
+	if score > 0 {
+		c.log.InfoContext(ctx, "suspicious order", "score", score, "findings", len(findings))
+	}
+	return &models.OrderFindings{OrderUID: orderUID, CheckedAt: &checkedAt, Score: score, Findings: findings}, nil
+}
+
+// OrderFindings returns what the last check of the order found, no
+// CheckedAt if it was never checked and apperr.ErrNotFound if the order
+// is unknown
+func (c *Checker) OrderFindings(ctx context.Context, orderUID string) (*models.OrderFindings, error) {
+	checkedAt, err := c.findings.CheckedAt(ctx, orderUID)
+	switch {
+	case errors.Is(err, apperr.ErrNotFound):
+		// Not checked yet or no order at all
+		if _, err := c.orders.GetOrderStatus(ctx, orderUID); err != nil {
+			return nil, err
+		}
+		return &models.OrderFindings{OrderUID: orderUID, Findings: []models.Finding{}}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	findings, err := c.findings.ListOrderFindings(ctx, orderUID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.OrderFindings{OrderUID: orderUID, CheckedAt: &checkedAt, Score: models.Score(findings), Findings: findings}, nil
+}
+
+// ErrInvalidSeverity is returned for an unknown severity filter
+var ErrInvalidSeverity = apperr.Errorf(apperr.ErrValidation, "severity must be low, medium or high")
+
+func (c *Checker) ListFindings(ctx context.Context, f repository.FindingFilter) (*repository.FindingPage, error) {
+	if f.Severity != "" && !f.Severity.Valid() {
+		return nil, ErrInvalidSeverity
+	}
+	return c.findings.ListFindings(ctx, f)
+}
@@ -0,0 +1,137 @@
+// Package anomaly looks for suspicious patterns in stored orders: reused
+// payment transactions, contacts shared by many customers, huge sales,
+// sums that don't add up, payment times far from the order date and
+// delivery costing more than the goods. Findings are kept per order in
+// order_findings, see models.Finding
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+// Rules
+const (
+	RuleTransactionReused = "transaction_reused"
+	RuleContactShared     = "contact_shared"
+	RuleHugeSale          = "huge_sale"
+	RuleAmountMismatch    = "amount_mismatch"
+	RulePaymentTimeSkew   = "payment_time_skew"
+	RuleDeliveryCostRatio = "delivery_cost_ratio"
+)
+
+type Config struct {
+	// Item sale in percent from which it counts as huge
+	MaxSale int
+	// Allowed distance between payment_dt and date_created
+	MaxPaymentSkew time.Duration
+	// Allowed delivery_cost / goods_total
+	MaxDeliveryRatio float64
+	// Distinct customers one phone or email may serve
+	MaxCustomersPerContact int
+	// How often stored orders never checked are looked for
+	BackfillInterval time.Duration
+}
+
+// Lookup answers what the rules ask about other orders
+type Lookup interface {
+	OrdersWithTransaction(ctx context.Context, transaction, exceptUID string) ([]string, error)
+	CustomersWithPhone(ctx context.Context, phone string) ([]string, error)
+	CustomersWithEmail(ctx context.Context, email string) ([]string, error)
+}
+
+// Evaluate runs every rule against o. The order itself is expected to be
+// stored already, so lookups see it
+func Evaluate(ctx context.Context, o *models.Order, lookup Lookup, cfg Config) ([]models.Finding, error) {
+	findings := []models.Finding{}
+	add := func(rule string, sev models.Severity, details map[string]any, format string, args ...any) {
+		findings = append(findings, models.Finding{
+			OrderUID: o.OrderUID,
+			Rule:     rule,
+			Severity: sev,
+			Message:  fmt.Sprintf(format, args...),
+			Details:  details,
+		})
+	}
+
+	// Cross-order rules
+	p := o.Payment
+	if p.Transaction != "" {
+		others, err := lookup.OrdersWithTransaction(ctx, p.Transaction, o.OrderUID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", RuleTransactionReused, err)
+		}
+		if len(others) > 0 {
+			add(RuleTransactionReused, models.SeverityHigh, map[string]any{"transaction": p.Transaction, "orders": others},
+				"payment transaction %s is used by %d other orders", p.Transaction, len(others))
+		}
+	}
+
+	contacts := []struct {
+		field, value string
+		customers    func(context.Context, string) ([]string, error)
+	}{
+		{"delivery.phone", o.Delivery.Phone, lookup.CustomersWithPhone},
+		{"delivery.email", o.Delivery.Email, lookup.CustomersWithEmail},
+	}
+	for _, c := range contacts {
+		if c.value == "" {
+			continue
+		}
+		customers, err := c.customers(ctx, c.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", RuleContactShared, err)
+		}
+		if len(customers) > cfg.MaxCustomersPerContact {
+			add(RuleContactShared, models.SeverityMedium, map[string]any{"field": c.field, "value": c.value, "customers": len(customers)},
+				"%s %s is shared by %d customers", c.field, c.value, len(customers))
+		}
+	}
+
+	// Rules on the order alone
+	var itemsTotal int
+	for i, item := range o.Items {
+		itemsTotal += item.TotalPrice
+		if item.Sale >= cfg.MaxSale {
+			add(RuleHugeSale, models.SeverityMedium, map[string]any{"item": i, "chrt_id": item.ChrtID, "sale": item.Sale},
+				"items[%d] is sold with a %d%% sale", i, item.Sale)
+		}
+	}
+
+	if sum := p.GoodsTotal + p.DeliveryCost + p.CustomFee; p.Amount != sum {
+		add(RuleAmountMismatch, models.SeverityHigh, map[string]any{"field": "payment.amount", "amount": p.Amount, "expected": sum},
+			"payment amount %d differs from goods_total + delivery_cost + custom_fee %d", p.Amount, sum)
+	}
+	if p.GoodsTotal != itemsTotal {
+		add(RuleAmountMismatch, models.SeverityHigh, map[string]any{"field": "payment.goods_total", "goods_total": p.GoodsTotal, "expected": itemsTotal},
+			"goods_total %d differs from the items total %d", p.GoodsTotal, itemsTotal)
+	}
+
+	if p.PaymentDt != 0 && !o.DateCreated.IsZero() {
+		paid := time.Unix(p.PaymentDt, 0)
+		skew := paid.Sub(o.DateCreated)
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > cfg.MaxPaymentSkew {
+			add(RulePaymentTimeSkew, models.SeverityLow, map[string]any{"payment_dt": paid.UTC(), "date_created": o.DateCreated.UTC(), "skew": skew.String()},
+				"payment is %s away from the order date", skew.Round(time.Minute))
+		}
+	}
+
+	switch {
+	case p.DeliveryCost > 0 && p.GoodsTotal <= 0:
+		add(RuleDeliveryCostRatio, models.SeverityMedium, map[string]any{"delivery_cost": p.DeliveryCost, "goods_total": p.GoodsTotal},
+			"delivery costs %d for goods worth nothing", p.DeliveryCost)
+	case p.GoodsTotal > 0:
+		if ratio := float64(p.DeliveryCost) / float64(p.GoodsTotal); ratio > cfg.MaxDeliveryRatio {
+			add(RuleDeliveryCostRatio, models.SeverityMedium, map[string]any{"delivery_cost": p.DeliveryCost, "goods_total": p.GoodsTotal, "ratio": ratio},
+				"delivery costs %.1f times the goods", ratio)
+		}
+	}
+
+	return findings, nil
+}
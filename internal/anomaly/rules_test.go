@@ -0,0 +1,116 @@
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+var testConfig = Config{
+	MaxSale:                70,
+	MaxPaymentSkew:         72 * time.Hour,
+	MaxDeliveryRatio:       1,
+	MaxCustomersPerContact: 3,
+}
+
+type fakeLookup struct {
+	transactions map[string][]string
+	phones       map[string][]string
+	emails       map[string][]string
+}
+
+func (f fakeLookup) OrdersWithTransaction(ctx context.Context, transaction, exceptUID string) ([]string, error) {
+	return f.transactions[transaction], nil
+}
+
+func (f fakeLookup) CustomersWithPhone(ctx context.Context, phone string) ([]string, error) {
+	return f.phones[phone], nil
+}
+
+func (f fakeLookup) CustomersWithEmail(ctx context.Context, email string) ([]string, error) {
+	return f.emails[email], nil
+}
+
+// cleanOrder has only what the rules look at, all of it consistent
+func cleanOrder() *models.Order {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return &models.Order{
+		OrderUID:    "anomaly-1",
+		CustomerID:  "buyer-1",
+		DateCreated: created,
+		Delivery:    models.Delivery{Phone: "+15550100", Email: "buyer@shop.test"},
+		Payment: models.Payment{
+			Transaction: "trx-anomaly-1", PaymentDt: created.Add(time.Hour).Unix(),
+			Amount: 110, DeliveryCost: 10, GoodsTotal: 100,
+		},
+		Items: []models.Item{{ChrtID: 7, Price: 100, TotalPrice: 100}},
+	}
+}
+
+func TestEvaluateClean(t *testing.T) {
+	got, err := Evaluate(context.Background(), cleanOrder(), fakeLookup{}, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Fatalf("expected no findings, got %+v", got)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(o *models.Order, l *fakeLookup)
+		want   []string // rule/severity
+	}{
+		{"transaction reused", func(o *models.Order, l *fakeLookup) {
+			l.transactions = map[string][]string{o.Payment.Transaction: {"other"}}
+		}, []string{"transaction_reused/high"}},
+		{"phone shared", func(o *models.Order, l *fakeLookup) {
+			l.phones = map[string][]string{o.Delivery.Phone: {"a", "b", "c", "d"}}
+			l.emails = map[string][]string{o.Delivery.Email: {"a", "b", "c"}}
+		}, []string{"contact_shared/medium"}},
+		{"huge sale", func(o *models.Order, l *fakeLookup) {
+			o.Items[0].Sale, o.Items[0].TotalPrice = 80, 20
+			o.Payment.GoodsTotal, o.Payment.DeliveryCost, o.Payment.Amount = 20, 0, 20
+		}, []string{"huge_sale/medium"}},
+		{"amount mismatch", func(o *models.Order, l *fakeLookup) {
+			o.Payment.Amount = 1
+			o.Payment.GoodsTotal += 5
+		}, []string{"amount_mismatch/high", "amount_mismatch/high"}},
+		{"payment long before order", func(o *models.Order, l *fakeLookup) {
+			o.Payment.PaymentDt = o.DateCreated.Add(-30 * 24 * time.Hour).Unix()
+		}, []string{"payment_time_skew/low"}},
+		{"delivery over goods", func(o *models.Order, l *fakeLookup) {
+			o.Payment.DeliveryCost, o.Payment.Amount = 150, 250
+		}, []string{"delivery_cost_ratio/medium"}},
+		{"delivery of nothing", func(o *models.Order, l *fakeLookup) {
+			o.Items = nil
+			o.Payment.GoodsTotal, o.Payment.Amount = 0, 10
+		}, []string{"delivery_cost_ratio/medium"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			o, l := cleanOrder(), fakeLookup{}
+			tc.change(o, &l)
+
+			findings, err := Evaluate(context.Background(), o, l, testConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range findings {
+				got = append(got, fmt.Sprintf("%s/%s", f.Rule, f.Severity))
+				if f.OrderUID != o.OrderUID || f.Message == "" {
+					t.Errorf("incomplete finding %+v", f)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("findings %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
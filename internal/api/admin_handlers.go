@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+const (
+	defaultOutboxStuckAfter = 5 * time.Minute
+	defaultOutboxListLimit  = 100
+)
+
+type AdminHandler struct {
+	outbox *repository.OutboxRepository
+	level  *slog.LevelVar
+	log    *slog.Logger
+}
+
+func NewAdminHandler(outbox *repository.OutboxRepository, level *slog.LevelVar, logger *slog.Logger) *AdminHandler {
+	return &AdminHandler{outbox: outbox, level: level, log: logger}
+}
+
+func (h *AdminHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/admin/outbox", h.ListOutbox)
+	r.Post("/admin/outbox/{id}/retry", h.RetryOutbox)
+	r.Get("/admin/log-level", h.GetLogLevel)
+	r.Put("/admin/log-level", h.SetLogLevel)
+}
+
+// ListOutbox shows failed (?status=failed) or stuck (?status=stuck, default)
+// outbox messages. Stuck means pending for longer than ?stuck_after
+func (h *AdminHandler) ListOutbox(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	status := q.Get("status")
+	switch status {
+	case "", "stuck":
+		status = "stuck"
+	case repository.OutboxFailed:
+	default:
+		writeProblem(w, r, http.StatusBadRequest, "status must be stuck or failed")
+		return
+	}
+
+	stuckAfter := defaultOutboxStuckAfter
+	if v := q.Get("stuck_after"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeProblem(w, r, http.StatusBadRequest, "invalid stuck_after")
+			return
+		}
+		stuckAfter = d
+	}
+
+	msgs, err := h.outbox.ListProblems(r.Context(), status, stuckAfter, defaultOutboxListLimit)
+	if err != nil {
+		writeError(w, r, h.log, "failed to list outbox", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msgs)
+}
+
+func (h *AdminHandler) RetryOutbox(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	ok, err := h.outbox.Retry(r.Context(), id)
+	if err != nil {
+		writeError(w, r, h.log, "failed to retry outbox message", err, "outbox_id", id)
+		return
+	}
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, "failed outbox message not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+func (h *AdminHandler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logLevel{Level: h.level.Level().String()})
+}
+
+// SetLogLevel changes the level without a restart, body {"level":"debug"}
+func (h *AdminHandler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "level must be debug, info, warn or error")
+		return
+	}
+
+	prev := h.level.Level()
+	h.level.Set(level)
+	h.log.WarnContext(r.Context(), "log level changed", "from", prev.String(), "to", level.String())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logLevel{Level: level.String()})
+}
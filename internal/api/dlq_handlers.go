@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tmozzze/order_checker/internal/kafka_consumer"
+	"github.com/tmozzze/order_checker/internal/logging"
+)
+
+const defaultDLQListLimit = 50
+
+type DLQHandler struct {
+	dlq *kafka_consumer.DeadLetterQueue
+	log *slog.Logger
+}
+
+func NewDLQHandler(dlq *kafka_consumer.DeadLetterQueue, logger *slog.Logger) *DLQHandler {
+	return &DLQHandler{dlq: dlq, log: logger}
+}
+
+func (h *DLQHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/dlq", h.List)
+	r.Get("/dlq/{partition}/{offset}", h.Get)
+	r.Post("/dlq/{partition}/{offset}/redrive", h.Redrive)
+}
+
+func (h *DLQHandler) List(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDLQListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeProblem(w, r, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	letters, err := h.dlq.List(r.Context(), limit)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadGateway, "failed to read DLQ")
+		h.log.ErrorContext(r.Context(), "DLQ list failed", "error", err)
+		return
+	}
+	if letters == nil {
+		letters = []kafka_consumer.DeadLetter{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letters)
+}
+
+func (h *DLQHandler) Get(w http.ResponseWriter, r *http.Request) {
+	partition, offset, ok := dlqPosition(w, r)
+	if !ok {
+		return
+	}
+
+	letter, err := h.dlq.Get(r.Context(), partition, offset)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letter)
+}
+
+func (h *DLQHandler) Redrive(w http.ResponseWriter, r *http.Request) {
+	partition, offset, ok := dlqPosition(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.dlq.Redrive(r.Context(), partition, offset); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	h.log.InfoContext(r.Context(), "DLQ message re-driven",
+		slog.Int(logging.KeyPartition, partition), slog.Int64(logging.KeyOffset, offset))
+}
+
+func dlqPosition(w http.ResponseWriter, r *http.Request) (int, int64, bool) {
+	partition, err := strconv.Atoi(chi.URLParam(r, "partition"))
+	if err != nil || partition < 0 {
+		writeProblem(w, r, http.StatusBadRequest, "invalid partition")
+		return 0, 0, false
+	}
+	offset, err := strconv.ParseInt(chi.URLParam(r, "offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeProblem(w, r, http.StatusBadRequest, "invalid offset")
+		return 0, 0, false
+	}
+	return partition, offset, true
+}
+
+func (h *DLQHandler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, kafka_consumer.ErrDeadLetterNotFound) {
+		writeProblem(w, r, http.StatusNotFound, "dead letter not found")
+		return
+	}
+	writeProblem(w, r, http.StatusBadGateway, "failed to read DLQ")
+	h.log.ErrorContext(r.Context(), "DLQ read failed", "error", err)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tmozzze/order_checker/internal/anomaly"
+	"github.com/tmozzze/order_checker/internal/logging"
+	"github.com/tmozzze/order_checker/internal/models"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+type FindingHandler struct {
+	checker *anomaly.Checker
+	log     *slog.Logger
+}
+
+func NewFindingHandler(checker *anomaly.Checker, logger *slog.Logger) *FindingHandler {
+	return &FindingHandler{checker: checker, log: logger}
+}
+
+func (h *FindingHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/findings", h.List)
+	r.Get("/orders/{id}/findings", h.GetOrderFindings)
+	r.Post("/orders/{id}/findings/check", h.CheckOrder)
+}
+
+// GetOrderFindings returns the score and findings of the last check
+func (h *FindingHandler) GetOrderFindings(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	res, err := h.checker.OrderFindings(r.Context(), id)
+	if err != nil {
+		writeError(w, r, h.log, "failed to get order findings", err, slog.String(logging.KeyOrderUID, id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// CheckOrder runs the rules again, e.g. for orders stored before the
+// checker or after a rule change
+func (h *FindingHandler) CheckOrder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	res, err := h.checker.Check(r.Context(), id)
+	if err != nil {
+		writeError(w, r, h.log, "failed to check order", err, slog.String(logging.KeyOrderUID, id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// List shows findings of all orders, newest first. ?severity and ?rule
+// filter, ?limit and ?cursor page
+func (h *FindingHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := repository.FindingFilter{
+		Severity: models.Severity(q.Get("severity")),
+		Rule:     q.Get("rule"),
+		Cursor:   q.Get("cursor"),
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeProblem(w, r, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		f.Limit = n
+	}
+
+	page, err := h.checker.ListFindings(r.Context(), f)
+	if err != nil {
+		writeError(w, r, h.log, "failed to list findings", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
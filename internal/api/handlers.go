@@ -2,37 +2,50 @@ package api
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/tmozzze/order_checker/internal/logging"
 	"github.com/tmozzze/order_checker/internal/models"
+	"github.com/tmozzze/order_checker/internal/repository"
 	"github.com/tmozzze/order_checker/internal/service"
+	"github.com/tmozzze/order_checker/internal/validation"
 )
 
 type OrderHandler struct {
-	service *service.OrderService
+	service  *service.OrderService
+	profiles *validation.Profiles
+	topic    string // where accepted orders go, selects the profile with entry
+	log      *slog.Logger
 }
 
-func NewOrderHandler(svc *service.OrderService) *OrderHandler {
-	return &OrderHandler{service: svc}
+func NewOrderHandler(svc *service.OrderService, profiles *validation.Profiles, topic string, logger *slog.Logger) *OrderHandler {
+	return &OrderHandler{service: svc, profiles: profiles, topic: topic, log: logger}
 }
 
 func (h *OrderHandler) RegisterRoutes(r chi.Router) {
 	r.Post("/orders", h.SaveOrder)
+	r.Get("/orders", h.ListOrders)
 	r.Get("/orders/{id}", h.GetOrder)
+	r.Get("/orders/{id}/status", h.GetStatus)
+	r.Patch("/orders/{id}/status", h.ChangeStatus)
+	r.Get("/orders/{id}/history", h.GetHistory)
+	r.Get("/submissions/{id}", h.GetSubmission)
 }
 
 func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "missing order id", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, "missing order id")
 		return
 	}
 
 	order, err := h.service.GetOrder(r.Context(), id)
 	if err != nil {
-		http.Error(w, "order not found", http.StatusNotFound)
+		writeError(w, r, h.log, "failed to get order", err, slog.String(logging.KeyOrderUID, id))
 		return
 	}
 
@@ -41,31 +54,160 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	f := repository.OrderFilter{
+		CustomerID:  q.Get("customer_id"),
+		TrackNumber: q.Get("track_number"),
+		Provider:    q.Get("provider"),
+		Currency:    q.Get("currency"),
+		City:        q.Get("city"),
+		Brand:       q.Get("brand"),
+		Sort:        q.Get("sort"),
+		Cursor:      q.Get("cursor"),
+	}
+
+	var err error
+	if f.CreatedFrom, err = parseTimeParam(q.Get("created_from")); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid created_from: "+err.Error())
+		return
+	}
+	if f.CreatedTo, err = parseTimeParam(q.Get("created_to")); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid created_to: "+err.Error())
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		f.Limit, err = strconv.Atoi(v)
+		if err != nil || f.Limit <= 0 {
+			writeProblem(w, r, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	page, err := h.service.ListOrders(r.Context(), f)
+	if err != nil {
+		writeError(w, r, h.log, "failed to list orders", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// Accepts RFC3339 timestamps or plain dates (2006-01-02)
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
 func (h *OrderHandler) SaveOrder(w http.ResponseWriter, r *http.Request) {
 	var order models.Order
 
 	// Decode json
 	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	if err := order.Validate(); err != nil {
-		http.Error(w, "invalid order: "+err.Error(), http.StatusBadRequest)
-		log.Printf("Validation failed: %v", err)
+	// The consumer checks again with the same profile, this answers early
+	if err := h.profiles.Select(order.Entry, h.topic).Check(&order).Err(); err != nil {
+		writeError(w, r, h.log, "invalid order", err)
+		h.log.InfoContext(r.Context(), "order validation failed", slog.String(logging.KeyOrderUID, order.OrderUID), "error", err)
 		return
 	}
 
 	// Service layer
 	ctx := r.Context()
-	if err := h.service.SaveOrder(ctx, &order); err != nil {
-		http.Error(w, "failed to save order", http.StatusInternalServerError)
-		log.Printf("Postgres error: %v", err)
+	sub, err := h.service.SaveOrder(ctx, &order, r.Header.Get("X-Actor"))
+	if err != nil {
+		writeError(w, r, h.log, "failed to save order", err, slog.String(logging.KeyOrderUID, order.OrderUID))
 		return
 	}
 
-	// Success
+	// Accepted: status is tracked by the submission
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/submissions/"+sub.ID)
 	w.WriteHeader(http.StatusAccepted)
-	log.Printf("Order %s saved", order.OrderUID)
+	json.NewEncoder(w).Encode(sub)
+}
+
+func (h *OrderHandler) GetSubmission(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	sub, err := h.service.GetSubmission(r.Context(), id)
+	if err != nil {
+		writeError(w, r, h.log, "failed to get submission", err, "submission_id", id)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sub)
+}
+
+func (h *OrderHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	view, err := h.service.GetStatus(r.Context(), id)
+	if err != nil {
+		writeError(w, r, h.log, "failed to get order status", err, slog.String(logging.KeyOrderUID, id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+type statusRequest struct {
+	Status models.OrderStatus `json:"status"`
+	Actor  string             `json:"actor"`
+	Reason string             `json:"reason"`
+}
+
+// ChangeStatus applies {"status": "paid", "actor": "...", "reason": "..."}.
+// The actor falls back to the X-Actor header, then to "api"
+func (h *OrderHandler) ChangeStatus(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req statusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Actor == "" {
+		req.Actor = r.Header.Get("X-Actor")
+	}
+	if req.Actor == "" {
+		req.Actor = "api"
+	}
+
+	src := models.EventSource{Source: models.SourceHTTP, Actor: req.Actor}
+	change, err := h.service.ChangeStatus(r.Context(), id, req.Status, src, req.Reason)
+	if err != nil {
+		writeError(w, r, h.log, "failed to change order status", err, slog.String(logging.KeyOrderUID, id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
+
+// GetHistory is the order timeline: arrival, redeliveries, rejected
+// conflicting payloads and status changes, oldest first
+func (h *OrderHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	history, err := h.service.GetHistory(r.Context(), id)
+	if err != nil {
+		writeError(w, r, h.log, "failed to get order history", err, slog.String(logging.KeyOrderUID, id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
 }
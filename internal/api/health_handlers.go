@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tmozzze/order_checker/internal/health"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+func (h *HealthHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/healthz", h.Liveness)
+	r.Get("/readyz", h.Readiness)
+}
+
+// Liveness only tells the process is able to answer
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": health.StatusOK})
+}
+
+// Readiness reports every dependency, 503 if any of them fails
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := h.checker.Check(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != health.StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/tmozzze/order_checker/internal/apperr"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body. Errors lists invalid fields
+// of a validation problem
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []apperr.FieldError `json:"errors,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string, fields ...apperr.FieldError) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: middleware.GetReqID(r.Context()),
+		Errors:    fields,
+	})
+}
+
+// writeError answers with the status of the error kind: validation 400,
+// not found 404, conflict 409, unavailable 503. Anything else is logged
+// with attrs and answered 500 with fallback as detail, so internals never
+// reach the client
+func writeError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, fallback string, err error, attrs ...any) {
+	switch {
+	case errors.Is(err, apperr.ErrValidation):
+		writeProblem(w, r, http.StatusBadRequest, err.Error(), apperr.Fields(err)...)
+	case errors.Is(err, apperr.ErrNotFound):
+		writeProblem(w, r, http.StatusNotFound, message(err))
+	case errors.Is(err, apperr.ErrConflict):
+		writeProblem(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, apperr.ErrUnavailable):
+		logger.WarnContext(r.Context(), fallback, append(attrs, "error", err)...)
+		w.Header().Set("Retry-After", "5")
+		writeProblem(w, r, http.StatusServiceUnavailable, message(err))
+	default:
+		logger.ErrorContext(r.Context(), fallback, append(attrs, "error", err)...)
+		writeProblem(w, r, http.StatusInternalServerError, fallback)
+	}
+}
+
+// message is the client-safe message of a domain error, without its cause
+func message(err error) string {
+	var e *apperr.Error
+	if errors.As(err, &e) {
+		return e.Message
+	}
+	return err.Error()
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/go-chi/chi/v5"
+	"github.com/tmozzze/order_checker/internal/stream"
+)
+
+const streamWriteTimeout = 10 * time.Second
+
+type StreamHandler struct {
+	hub       *stream.Hub
+	heartbeat time.Duration
+	log       *slog.Logger
+}
+
+func NewStreamHandler(hub *stream.Hub, heartbeat time.Duration, logger *slog.Logger) *StreamHandler {
+	return &StreamHandler{hub: hub, heartbeat: heartbeat, log: logger}
+}
+
+func (h *StreamHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/orders/stream", h.SSE)
+	r.Get("/orders/ws", h.WebSocket)
+}
+
+// streamParams reads ?customer_id, ?provider, ?status and the last seen
+// event ID from the Last-Event-ID header or ?last_event_id
+func streamParams(w http.ResponseWriter, r *http.Request) (stream.Filter, uint64, bool) {
+	q := r.URL.Query()
+	f := stream.Filter{
+		CustomerID: q.Get("customer_id"),
+		Provider:   q.Get("provider"),
+		Status:     q.Get("status"),
+	}
+	switch f.Status {
+	case "", "persisted", "rejected", "dead_lettered":
+	default:
+		writeProblem(w, r, http.StatusBadRequest, "status must be persisted, rejected or dead_lettered")
+		return f, 0, false
+	}
+
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = q.Get("last_event_id")
+	}
+	var lastID uint64
+	if v != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "invalid last event id")
+			return f, 0, false
+		}
+	}
+	return f, lastID, true
+}
+
+// SSE streams order events as text/event-stream. Browsers reconnect on
+// their own and send Last-Event-ID, so nothing is missed while it is
+// still in the replay ring
+func (h *StreamHandler) SSE(w http.ResponseWriter, r *http.Request) {
+	f, lastID, ok := streamParams(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeProblem(w, r, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	client, truncated := h.hub.Subscribe(lastID, f)
+	defer client.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if truncated {
+		fmt.Fprint(w, "event: truncated\ndata: {}\n\n")
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.Done():
+			fmt.Fprintf(w, "event: error\ndata: %q\n\n", client.Err().Error())
+			flusher.Flush()
+			return
+		case e := <-client.Events():
+			data, err := json.Marshal(e)
+			if err != nil {
+				h.log.ErrorContext(r.Context(), "failed to encode stream event", "event_id", e.ID, "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+			client.Sent(e.ID)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// WebSocket pushes the same events as JSON text messages. A dropped
+// client reconnects with ?last_event_id to resume
+func (h *StreamHandler) WebSocket(w http.ResponseWriter, r *http.Request) {
+	f, lastID, ok := streamParams(w, r)
+	if !ok {
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		h.log.WarnContext(r.Context(), "websocket accept failed", "error", err)
+		return
+	}
+	defer conn.CloseNow()
+
+	client, truncated := h.hub.Subscribe(lastID, f)
+	defer client.Close()
+
+	// The feed is one-way, CloseRead handles pings and the close handshake
+	ctx := conn.CloseRead(r.Context())
+
+	write := func(v any) error {
+		wctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+		defer cancel()
+		return wsjson.Write(wctx, conn, v)
+	}
+
+	if truncated {
+		if err := write(map[string]string{"type": "stream.truncated"}); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-client.Done():
+			conn.Close(websocket.StatusTryAgainLater, client.Err().Error())
+			return
+		case e := <-client.Events():
+			if err := write(e); err != nil {
+				return
+			}
+			client.Sent(e.ID)
+		case <-heartbeat.C:
+			pctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err := conn.Ping(pctx)
+			cancel()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tmozzze/order_checker/internal/events"
+	"github.com/tmozzze/order_checker/internal/repository"
+	"github.com/tmozzze/order_checker/internal/webhook"
+)
+
+const (
+	defaultDeliveryListLimit = 50
+	maxDeliveryListLimit     = 500
+)
+
+type WebhookHandler struct {
+	repo *repository.WebhookRepository
+	log  *slog.Logger
+}
+
+func NewWebhookHandler(repo *repository.WebhookRepository, logger *slog.Logger) *WebhookHandler {
+	return &WebhookHandler{repo: repo, log: logger}
+}
+
+func (h *WebhookHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/webhooks", h.Create)
+	r.Get("/webhooks", h.List)
+	r.Get("/webhooks/{id}", h.Get)
+	r.Put("/webhooks/{id}", h.Update)
+	r.Delete("/webhooks/{id}", h.Delete)
+	r.Get("/webhooks/{id}/deliveries", h.ListDeliveries)
+	r.Post("/webhooks/{id}/deliveries/{deliveryID}/retry", h.RetryDelivery)
+}
+
+type webhookRequest struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+}
+
+func (req webhookRequest) validate() error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	for _, t := range req.EventTypes {
+		if !slices.Contains(webhook.EventTypes, events.Type(t)) {
+			return errors.New("unknown event type " + t)
+		}
+	}
+	return nil
+}
+
+// Create registers a subscription. The secret is generated when not given
+// and only returned here, store it to verify signatures
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s := &repository.WebhookSubscription{
+		URL:        req.URL,
+		Secret:     req.Secret,
+		EventTypes: req.EventTypes,
+		Active:     req.Active == nil || *req.Active,
+	}
+	if s.Secret == "" {
+		s.Secret = webhook.NewSecret()
+	}
+
+	if err := h.repo.CreateSubscription(r.Context(), s); err != nil {
+		writeError(w, r, h.log, "failed to create webhook", err)
+		return
+	}
+	h.log.InfoContext(r.Context(), "webhook created", "subscription_id", s.ID, "url", s.URL)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/webhooks/"+strconv.FormatInt(s.ID, 10))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.repo.ListSubscriptions(r.Context())
+	if err != nil {
+		writeError(w, r, h.log, "failed to list webhooks", err)
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+func (h *WebhookHandler) Get(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.subscription(w, r)
+	if !ok {
+		return
+	}
+	s.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// Update replaces url and event types. Secret and active are kept unless given
+func (h *WebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.subscription(w, r)
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.URL = req.URL
+	s.EventTypes = req.EventTypes
+	if req.Secret != "" {
+		s.Secret = req.Secret
+	}
+	if req.Active != nil {
+		s.Active = *req.Active
+	}
+
+	if err := h.repo.UpdateSubscription(r.Context(), s); err != nil {
+		writeError(w, r, h.log, "failed to update webhook", err, "subscription_id", s.ID)
+		return
+	}
+	s.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	found, err := h.repo.DeleteSubscription(r.Context(), id)
+	if err != nil {
+		writeError(w, r, h.log, "failed to delete webhook", err, "subscription_id", id)
+		return
+	}
+	if !found {
+		writeProblem(w, r, http.StatusNotFound, "webhook not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries shows delivery history, newest first. ?status filters by
+// pending, delivered or dead, ?limit caps the result
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.subscription(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	status := q.Get("status")
+	switch status {
+	case "", repository.WebhookPending, repository.WebhookDelivered, repository.WebhookDead:
+	default:
+		writeProblem(w, r, http.StatusBadRequest, "status must be pending, delivered or dead")
+		return
+	}
+
+	limit := defaultDeliveryListLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeProblem(w, r, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, maxDeliveryListLimit)
+	}
+
+	ds, err := h.repo.ListDeliveries(r.Context(), s.ID, status, limit)
+	if err != nil {
+		writeError(w, r, h.log, "failed to list deliveries", err, "subscription_id", s.ID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ds)
+}
+
+// RetryDelivery sends a dead delivery again from attempt one
+func (h *WebhookHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := pathID(w, r, "deliveryID")
+	if !ok {
+		return
+	}
+
+	found, err := h.repo.RetryDelivery(r.Context(), id, deliveryID)
+	if err != nil {
+		writeError(w, r, h.log, "failed to retry delivery", err, "delivery_id", deliveryID)
+		return
+	}
+	if !found {
+		writeProblem(w, r, http.StatusNotFound, "dead delivery not found")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *WebhookHandler) subscription(w http.ResponseWriter, r *http.Request) (*repository.WebhookSubscription, bool) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil, false
+	}
+
+	s, err := h.repo.GetSubscription(r.Context(), id)
+	if err != nil {
+		writeError(w, r, h.log, "failed to get webhook", err, "subscription_id", id)
+		return nil, false
+	}
+	return s, true
+}
+
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil || id <= 0 {
+		writeProblem(w, r, http.StatusBadRequest, "invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
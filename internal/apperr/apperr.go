@@ -0,0 +1,89 @@
+// Package apperr holds the domain errors shared by the repository, the
+// service and the API. Each error has a kind the API maps to a status
+// code and a message that is safe to show to clients
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kinds, match them with errors.Is
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrValidation  = errors.New("validation failed")
+	ErrConflict    = errors.New("conflict")
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// FieldError is one invalid field, Field is a JSON path like items[0].price.
+// Rule names the check that failed, when there is one
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Rule    string `json:"rule,omitempty"`
+}
+
+// Error is a domain error of one kind. errors.Is matches both the kind
+// and the cause, so a not-found error still matches pgx.ErrNoRows
+type Error struct {
+	Kind    error
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if len(e.Fields) > 0 {
+		parts := make([]string, len(e.Fields))
+		for i, f := range e.Fields {
+			parts[i] = f.Field + " " + f.Message
+		}
+		msg += ": " + strings.Join(parts, ", ")
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// NotFound says what does not exist, like NotFound("order", pgx.ErrNoRows)
+func NotFound(what string, cause error) *Error {
+	return &Error{Kind: ErrNotFound, Message: what + " not found", Err: cause}
+}
+
+func Validation(message string, fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Message: message, Fields: fields}
+}
+
+func Conflict(message string, cause error) *Error {
+	return &Error{Kind: ErrConflict, Message: message, Err: cause}
+}
+
+// Unavailable marks a failed dependency, the client may retry later
+func Unavailable(cause error) *Error {
+	return &Error{Kind: ErrUnavailable, Message: "storage unavailable", Err: cause}
+}
+
+// Errorf creates an error of kind with a formatted message
+func Errorf(kind error, format string, args ...any) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// Fields returns the field details of a validation error, if any
+func Fields(err error) []FieldError {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Fields
+	}
+	return nil
+}
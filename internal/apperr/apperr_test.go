@@ -0,0 +1,24 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorMatchesKindAndCause(t *testing.T) {
+	cause := errors.New("no rows in result set")
+	err := fmt.Errorf("get order: %w", NotFound("order", cause))
+
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, cause) {
+		t.Fatalf("%v should match both its kind and its cause", err)
+	}
+	if errors.Is(err, ErrConflict) {
+		t.Fatal("not-found error matches ErrConflict")
+	}
+
+	v := Validation("invalid order", FieldError{Field: "items[0].price", Message: "must be positive"})
+	if !errors.Is(v, ErrValidation) || len(Fields(fmt.Errorf("wrapped: %w", v))) != 1 {
+		t.Fatalf("unexpected validation error %v", v)
+	}
+}
@@ -18,6 +18,21 @@ type Cache struct {
 	mu       sync.RWMutex
 	ll       *list.List
 	store    map[string]*list.Element
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+
+	onEvict func(key string, value interface{})
+}
+
+// Stats is a snapshot of cache counters
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+	Capacity  int
 }
 
 func New(capacity int) *Cache {
@@ -29,36 +44,56 @@ func New(capacity int) *Cache {
 
 }
 
-func (c *Cache) Set(key string, value interface{}) {
+// OnEvict registers fn to be called for every entry the LRU policy
+// evicts. fn runs after the cache lock is released
+func (c *Cache) OnEvict(fn func(key string, value interface{})) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.onEvict = fn
+}
+
+func (c *Cache) Set(key string, value interface{}) {
+	c.mu.Lock()
 
 	if elem, ok := c.store[key]; ok {
 		c.ll.MoveToFront(elem)
 		elem.Value.(*entry).value = value
+		c.mu.Unlock()
 		return
 	}
 
 	elem := c.ll.PushFront(&entry{key: key, value: value})
 	c.store[key] = elem
 
+	var evicted *entry
 	if c.ll.Len() > c.capacity {
 		back := c.ll.Back()
 		if back != nil {
 			c.ll.Remove(back)
-			delete(c.store, back.Value.(*entry).key)
+			evicted = back.Value.(*entry)
+			delete(c.store, evicted.key)
+			c.evictions++
 		}
 	}
+	onEvict := c.onEvict
+	c.mu.Unlock()
+
+	if evicted != nil && onEvict != nil {
+		onEvict(evicted.key, evicted.value)
+	}
 }
 
 func (c *Cache) Get(key string) (interface{}, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	// MoveToFront mutates the list, so a read lock is not enough
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	if elem, ok := c.store[key]; ok {
 		c.ll.MoveToFront(elem)
+		c.hits++
 		return elem.Value.(*entry).value, true
 	}
+	c.misses++
 	return nil, false
 }
 
@@ -74,13 +109,30 @@ func (c *Cache) Delete(key string) error {
 	return nil
 }
 
-func (c *Cache) LoadAll(orders []models.Order) {
-	for i, order := range orders {
-		c.Set(order.OrderUID, order)
-		if i == c.capacity {
-			return
+// LoadAll preloads orders sorted most-recent-first. Every order is appended
+// behind the entries already cached, so warm data never evicts live data.
+// Returns how many orders were actually loaded.
+func (c *Cache) LoadAll(orders []models.Order) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	loaded := 0
+	for i := range orders {
+		if c.ll.Len() >= c.capacity {
+			break
 		}
+		order := &orders[i]
+		if _, ok := c.store[order.OrderUID]; ok {
+			continue
+		}
+		c.store[order.OrderUID] = c.ll.PushBack(&entry{key: order.OrderUID, value: order})
+		loaded++
 	}
+	return loaded
+}
+
+func (c *Cache) Capacity() int {
+	return c.capacity
 }
 
 func (c *Cache) Len() int {
@@ -88,3 +140,29 @@ func (c *Cache) Len() int {
 	defer c.mu.Unlock()
 	return c.ll.Len()
 }
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      c.ll.Len(),
+		Capacity:  c.capacity,
+	}
+}
+
+// OrderCache is the cache used by the service, the consumer and the
+// warm-up. Values are *models.Order
+type OrderCache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{})
+	Delete(key string) error
+	// LoadAll adds orders without evicting anything, see Cache.LoadAll
+	LoadAll(orders []models.Order) int
+	Capacity() int
+	Stats() Stats
+}
+
+var _ OrderCache = (*Cache)(nil)
@@ -2,38 +2,537 @@ package config
 
 import (
 	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
+const redacted = "******"
+
 type Config struct {
-	DBUser     string
-	DBPassword string
-	DBHost     string
-	DBPort     string
-	DBName     string
+	DB         DBConfig         `yaml:"db"`
+	Kafka      KafkaConfig      `yaml:"kafka"`
+	Cache      CacheConfig      `yaml:"cache"`
+	HTTP       HTTPConfig       `yaml:"http"`
+	Outbox     OutboxConfig     `yaml:"outbox"`
+	Health     HealthConfig     `yaml:"health"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Log        LogConfig        `yaml:"log"`
+	Stream     StreamConfig     `yaml:"stream"`
+	Webhooks   WebhookConfig    `yaml:"webhooks"`
+	Validation ValidationConfig `yaml:"validation"`
+	Anomaly    AnomalyConfig    `yaml:"anomaly"`
+	Timezone   string           `yaml:"timezone"`
+
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// Set by --print-config, never read from file
+	PrintConfig bool `yaml:"-"`
+}
+
+type DBConfig struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Name     string `yaml:"name"`
+	// Apply pending migrations on start, otherwise run `app migrate up`
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+type KafkaConfig struct {
+	Brokers           []string    `yaml:"brokers"`
+	Topic             string      `yaml:"topic"`
+	DLQTopic          string      `yaml:"dlq_topic"`
+	GroupID           string      `yaml:"group_id"`
+	StatusTopic       string      `yaml:"status_topic"`
+	StatusGroupID     string      `yaml:"status_group_id"`
+	StatusDLQTopic    string      `yaml:"status_dlq_topic"`
+	MaxLag            int64       `yaml:"max_lag"`
+	Partitions        int         `yaml:"partitions"`
+	ReplicationFactor int         `yaml:"replication_factor"`
+	Retry             RetryConfig `yaml:"retry"`
+}
+
+type RetryConfig struct {
+	InitialInterval time.Duration `yaml:"initial_interval"`
+	MaxInterval     time.Duration `yaml:"max_interval"`
+	Multiplier      float64       `yaml:"multiplier"`
+	MaxAttempts     int           `yaml:"max_attempts"`
+	AttemptTimeout  time.Duration `yaml:"attempt_timeout"`
+}
+
+type CacheConfig struct {
+	Capacity      int           `yaml:"capacity"`
+	WarmupBatch   int           `yaml:"warmup_batch"`
+	WarmupTimeout time.Duration `yaml:"warmup_timeout"`
+}
+
+type HTTPConfig struct {
+	Addr      string `yaml:"addr"`
+	StaticDir string `yaml:"static_dir"`
+}
+
+type HealthConfig struct {
+	CheckTimeout time.Duration `yaml:"check_timeout"`
+}
+
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter"` // none, stdout, file, otlp
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	OTLPInsecure bool    `yaml:"otlp_insecure"`
+	File         string  `yaml:"file"`
+	ServiceName  string  `yaml:"service_name"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn, error
+	Format string `yaml:"format"` // json, text
+}
+
+type StreamConfig struct {
+	ReplaySize   int           `yaml:"replay_size"`
+	ClientBuffer int           `yaml:"client_buffer"`
+	Heartbeat    time.Duration `yaml:"heartbeat"`
+}
+
+type WebhookConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+	Timeout      time.Duration `yaml:"timeout"`
+	RetryInitial time.Duration `yaml:"retry_initial"`
+	RetryMax     time.Duration `yaml:"retry_max"`
 }
 
-func Load() (*Config, error) {
+type ValidationConfig struct {
+	// YAML file with validation profiles, empty for the built-in strict one
+	ProfilesFile string `yaml:"profiles_file"`
+}
+
+type AnomalyConfig struct {
+	MaxSale                int           `yaml:"max_sale"` // percent
+	MaxPaymentSkew         time.Duration `yaml:"max_payment_skew"`
+	MaxDeliveryRatio       float64       `yaml:"max_delivery_ratio"` // delivery_cost / goods_total
+	MaxCustomersPerContact int           `yaml:"max_customers_per_contact"`
+	BackfillInterval       time.Duration `yaml:"backfill_interval"`
+}
 
-	if err := godotenv.Load(); err != nil {
-		fmt.Println(".env not found. Skip")
+type OutboxConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+}
+
+func Default() *Config {
+	return &Config{
+		DB: DBConfig{
+			Host:        "localhost",
+			Port:        "5432",
+			AutoMigrate: true,
+		},
+		Kafka: KafkaConfig{
+			Brokers:           []string{"localhost:9092"},
+			Topic:             "orders",
+			DLQTopic:          "orders.dlq",
+			GroupID:           "test-group",
+			StatusTopic:       "orders.status",
+			StatusGroupID:     "order-status",
+			StatusDLQTopic:    "orders.status.dlq",
+			MaxLag:            10000,
+			Partitions:        1,
+			ReplicationFactor: 1,
+			Retry: RetryConfig{
+				InitialInterval: 200 * time.Millisecond,
+				MaxInterval:     30 * time.Second,
+				Multiplier:      2,
+				MaxAttempts:     10,
+				AttemptTimeout:  10 * time.Second,
+			},
+		},
+		Cache: CacheConfig{
+			Capacity:      100,
+			WarmupBatch:   25,
+			WarmupTimeout: 30 * time.Second,
+		},
+		HTTP: HTTPConfig{
+			Addr:      ":8080",
+			StaticDir: "./web",
+		},
+		Outbox: OutboxConfig{
+			PollInterval: time.Second,
+			BatchSize:    100,
+			MaxAttempts:  10,
+		},
+		Health: HealthConfig{
+			CheckTimeout: 2 * time.Second,
+		},
+		Tracing: TracingConfig{
+			Exporter:     "none",
+			OTLPEndpoint: "localhost:4318",
+			OTLPInsecure: true,
+			File:         "traces.json",
+			ServiceName:  "order-checker",
+			SampleRatio:  1,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Stream: StreamConfig{
+			ReplaySize:   1000,
+			ClientBuffer: 64,
+			Heartbeat:    15 * time.Second,
+		},
+		Webhooks: WebhookConfig{
+			PollInterval: time.Second,
+			BatchSize:    20,
+			MaxAttempts:  8,
+			Timeout:      10 * time.Second,
+			RetryInitial: 5 * time.Second,
+			RetryMax:     time.Hour,
+		},
+		Anomaly: AnomalyConfig{
+			MaxSale:                70,
+			MaxPaymentSkew:         72 * time.Hour,
+			MaxDeliveryRatio:       1,
+			MaxCustomersPerContact: 3,
+			BackfillInterval:       5 * time.Minute,
+		},
+		Timezone:        "Europe/Moscow",
+		ShutdownTimeout: 15 * time.Second,
 	}
+}
+
+// setting binds one config field to its file key, env var and CLI flag.
+// The flag name is the file key, e.g. --kafka.brokers
+type setting struct {
+	key    string
+	env    string
+	secret bool
+	ptr    any
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"db.user", "POSTGRES_USER", false, &c.DB.User},
+		{"db.password", "POSTGRES_PASSWORD", true, &c.DB.Password},
+		{"db.host", "POSTGRES_HOST", false, &c.DB.Host},
+		{"db.port", "POSTGRES_PORT", false, &c.DB.Port},
+		{"db.name", "POSTGRES_DB", false, &c.DB.Name},
+		{"db.auto_migrate", "DB_AUTO_MIGRATE", false, &c.DB.AutoMigrate},
+
+		{"kafka.brokers", "KAFKA_BROKERS", false, &c.Kafka.Brokers},
+		{"kafka.topic", "KAFKA_TOPIC", false, &c.Kafka.Topic},
+		{"kafka.dlq_topic", "KAFKA_DLQ_TOPIC", false, &c.Kafka.DLQTopic},
+		{"kafka.group_id", "KAFKA_GROUP_ID", false, &c.Kafka.GroupID},
+		{"kafka.status_topic", "KAFKA_STATUS_TOPIC", false, &c.Kafka.StatusTopic},
+		{"kafka.status_group_id", "KAFKA_STATUS_GROUP_ID", false, &c.Kafka.StatusGroupID},
+		{"kafka.status_dlq_topic", "KAFKA_STATUS_DLQ_TOPIC", false, &c.Kafka.StatusDLQTopic},
+		{"kafka.max_lag", "KAFKA_MAX_LAG", false, &c.Kafka.MaxLag},
+		{"kafka.partitions", "KAFKA_PARTITIONS", false, &c.Kafka.Partitions},
+		{"kafka.replication_factor", "KAFKA_REPLICATION_FACTOR", false, &c.Kafka.ReplicationFactor},
+		{"kafka.retry.initial_interval", "KAFKA_RETRY_INITIAL_INTERVAL", false, &c.Kafka.Retry.InitialInterval},
+		{"kafka.retry.max_interval", "KAFKA_RETRY_MAX_INTERVAL", false, &c.Kafka.Retry.MaxInterval},
+		{"kafka.retry.multiplier", "KAFKA_RETRY_MULTIPLIER", false, &c.Kafka.Retry.Multiplier},
+		{"kafka.retry.max_attempts", "KAFKA_RETRY_MAX_ATTEMPTS", false, &c.Kafka.Retry.MaxAttempts},
+		{"kafka.retry.attempt_timeout", "KAFKA_RETRY_ATTEMPT_TIMEOUT", false, &c.Kafka.Retry.AttemptTimeout},
+
+		{"cache.capacity", "CACHE_CAPACITY", false, &c.Cache.Capacity},
+		{"cache.warmup_batch", "CACHE_WARMUP_BATCH", false, &c.Cache.WarmupBatch},
+		{"cache.warmup_timeout", "CACHE_WARMUP_TIMEOUT", false, &c.Cache.WarmupTimeout},
+
+		{"http.addr", "HTTP_ADDR", false, &c.HTTP.Addr},
+		{"http.static_dir", "HTTP_STATIC_DIR", false, &c.HTTP.StaticDir},
 
-	cfg := &Config{
-		DBUser:     os.Getenv("POSTGRES_USER"),
-		DBPassword: os.Getenv("POSTGRES_PASSWORD"),
-		DBHost:     os.Getenv("POSTGRES_HOST"),
-		DBPort:     os.Getenv("POSTGRES_PORT"),
-		DBName:     os.Getenv("POSTGRES_DB"),
+		{"outbox.poll_interval", "OUTBOX_POLL_INTERVAL", false, &c.Outbox.PollInterval},
+		{"outbox.batch_size", "OUTBOX_BATCH_SIZE", false, &c.Outbox.BatchSize},
+		{"outbox.max_attempts", "OUTBOX_MAX_ATTEMPTS", false, &c.Outbox.MaxAttempts},
+
+		{"health.check_timeout", "HEALTH_CHECK_TIMEOUT", false, &c.Health.CheckTimeout},
+
+		{"tracing.exporter", "TRACING_EXPORTER", false, &c.Tracing.Exporter},
+		{"tracing.otlp_endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT", false, &c.Tracing.OTLPEndpoint},
+		{"tracing.otlp_insecure", "TRACING_OTLP_INSECURE", false, &c.Tracing.OTLPInsecure},
+		{"tracing.file", "TRACING_FILE", false, &c.Tracing.File},
+		{"tracing.service_name", "OTEL_SERVICE_NAME", false, &c.Tracing.ServiceName},
+		{"tracing.sample_ratio", "TRACING_SAMPLE_RATIO", false, &c.Tracing.SampleRatio},
+
+		{"log.level", "LOG_LEVEL", false, &c.Log.Level},
+		{"log.format", "LOG_FORMAT", false, &c.Log.Format},
+
+		{"stream.replay_size", "STREAM_REPLAY_SIZE", false, &c.Stream.ReplaySize},
+		{"stream.client_buffer", "STREAM_CLIENT_BUFFER", false, &c.Stream.ClientBuffer},
+		{"stream.heartbeat", "STREAM_HEARTBEAT", false, &c.Stream.Heartbeat},
+
+		{"webhooks.poll_interval", "WEBHOOKS_POLL_INTERVAL", false, &c.Webhooks.PollInterval},
+		{"webhooks.batch_size", "WEBHOOKS_BATCH_SIZE", false, &c.Webhooks.BatchSize},
+		{"webhooks.max_attempts", "WEBHOOKS_MAX_ATTEMPTS", false, &c.Webhooks.MaxAttempts},
+		{"webhooks.timeout", "WEBHOOKS_TIMEOUT", false, &c.Webhooks.Timeout},
+		{"webhooks.retry_initial", "WEBHOOKS_RETRY_INITIAL", false, &c.Webhooks.RetryInitial},
+		{"webhooks.retry_max", "WEBHOOKS_RETRY_MAX", false, &c.Webhooks.RetryMax},
+
+		{"validation.profiles_file", "VALIDATION_PROFILES_FILE", false, &c.Validation.ProfilesFile},
+
+		{"anomaly.max_sale", "ANOMALY_MAX_SALE", false, &c.Anomaly.MaxSale},
+		{"anomaly.max_payment_skew", "ANOMALY_MAX_PAYMENT_SKEW", false, &c.Anomaly.MaxPaymentSkew},
+		{"anomaly.max_delivery_ratio", "ANOMALY_MAX_DELIVERY_RATIO", false, &c.Anomaly.MaxDeliveryRatio},
+		{"anomaly.max_customers_per_contact", "ANOMALY_MAX_CUSTOMERS_PER_CONTACT", false, &c.Anomaly.MaxCustomersPerContact},
+		{"anomaly.backfill_interval", "ANOMALY_BACKFILL_INTERVAL", false, &c.Anomaly.BackfillInterval},
+
+		{"timezone", "APP_TIMEZONE", false, &c.Timezone},
+		{"shutdown_timeout", "SHUTDOWN_TIMEOUT", false, &c.ShutdownTimeout},
 	}
+}
+
+// Load builds the config in layers: defaults, then the YAML file
+// (--config or CONFIG_FILE), then env vars (.env included), then CLI flags.
+// All parse and validation errors are reported together. The config is
+// returned with them, merged as far as possible, so --print-config can
+// show it. Only bad command line syntax gives no config
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	// Flags are parsed first to find --config, but applied last
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to YAML config file")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print effective config with secrets redacted and exit")
 
-	if cfg.DBUser == "" || cfg.DBPassword == "" {
-		err := errors.New("DB_USER or DB_PASSWORD is empty")
+	type flagValue struct {
+		s   setting
+		raw string
+	}
+	var flagValues []flagValue
+	for _, s := range settings {
+		fs.Func(s.key, "overrides "+s.env, func(raw string) error {
+			flagValues = append(flagValues, flagValue{s, raw})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
 		return nil, err
 	}
 
-	return cfg, nil
+	var errs []error
+
+	// File
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Env, .env is optional
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		errs = append(errs, fmt.Errorf(".env: %w", err))
+	}
+	for _, s := range settings {
+		if raw, ok := os.LookupEnv(s.env); ok {
+			if err := setValue(s.ptr, raw); err != nil {
+				errs = append(errs, fmt.Errorf("env %s: %w", s.env, err))
+			}
+		}
+	}
+
+	// Flags
+	for _, f := range flagValues {
+		if err := setValue(f.s.ptr, f.raw); err != nil {
+			errs = append(errs, fmt.Errorf("flag --%s: %w", f.s.key, err))
+		}
+	}
+
+	errs = append(errs, cfg.validate()...)
+	return cfg, errors.Join(errs...)
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// setValue parses raw into the field ptr points to
+func setValue(ptr any, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch p := ptr.(type) {
+	case *string:
+		*p = raw
+	case *bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		*p = v
+	case *int:
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		*p = v
+	case *int64:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		*p = v
+	case *float64:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		*p = v
+	case *time.Duration:
+		v, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		*p = v
+	case *[]string:
+		var list []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*p = list
+	default:
+		return fmt.Errorf("unsupported config type %T", ptr)
+	}
+	return nil
+}
+
+func (c *Config) validate() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.DB.User != "", "db.user is required")
+	check(c.DB.Password != "", "db.password is required")
+	check(c.DB.Host != "", "db.host is required")
+	port, err := strconv.Atoi(c.DB.Port)
+	check(err == nil && port > 0 && port < 65536, "db.port must be a valid port, got %q", c.DB.Port)
+
+	check(len(c.Kafka.Brokers) > 0, "kafka.brokers must not be empty")
+	check(c.Kafka.Topic != "", "kafka.topic is required")
+	check(c.Kafka.DLQTopic != "", "kafka.dlq_topic is required")
+	check(c.Kafka.DLQTopic != c.Kafka.Topic, "kafka.dlq_topic must differ from kafka.topic")
+	check(c.Kafka.GroupID != "", "kafka.group_id is required")
+	check(c.Kafka.StatusTopic != "", "kafka.status_topic is required")
+	check(c.Kafka.StatusTopic != c.Kafka.Topic && c.Kafka.StatusTopic != c.Kafka.DLQTopic,
+		"kafka.status_topic must differ from kafka.topic and kafka.dlq_topic")
+	check(c.Kafka.StatusGroupID != "", "kafka.status_group_id is required")
+	check(c.Kafka.StatusGroupID != c.Kafka.GroupID, "kafka.status_group_id must differ from kafka.group_id")
+	check(c.Kafka.StatusDLQTopic != "", "kafka.status_dlq_topic is required")
+	check(c.Kafka.StatusDLQTopic != c.Kafka.Topic && c.Kafka.StatusDLQTopic != c.Kafka.DLQTopic && c.Kafka.StatusDLQTopic != c.Kafka.StatusTopic,
+		"kafka.status_dlq_topic must differ from kafka.topic, kafka.dlq_topic and kafka.status_topic")
+	check(c.Kafka.MaxLag >= 0, "kafka.max_lag must not be negative")
+	check(c.Kafka.Partitions > 0, "kafka.partitions must be positive")
+	check(c.Kafka.ReplicationFactor > 0, "kafka.replication_factor must be positive")
+	check(c.Kafka.Retry.InitialInterval > 0, "kafka.retry.initial_interval must be positive")
+	check(c.Kafka.Retry.MaxInterval >= c.Kafka.Retry.InitialInterval, "kafka.retry.max_interval must be >= initial_interval")
+	check(c.Kafka.Retry.Multiplier >= 1, "kafka.retry.multiplier must be >= 1")
+	check(c.Kafka.Retry.MaxAttempts > 0, "kafka.retry.max_attempts must be positive")
+	check(c.Kafka.Retry.AttemptTimeout > 0, "kafka.retry.attempt_timeout must be positive")
+
+	check(c.Cache.Capacity > 0, "cache.capacity must be positive")
+	check(c.Cache.WarmupBatch > 0, "cache.warmup_batch must be positive")
+	check(c.Cache.WarmupTimeout > 0, "cache.warmup_timeout must be positive")
+
+	check(c.HTTP.Addr != "", "http.addr is required")
+	check(c.HTTP.StaticDir != "", "http.static_dir is required")
+
+	check(c.Health.CheckTimeout > 0, "health.check_timeout must be positive")
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	case "file":
+		check(c.Tracing.File != "", "tracing.file is required for the file exporter")
+	default:
+		check(false, "tracing.exporter must be one of none, stdout, file, otlp, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.Exporter == "otlp" {
+		check(c.Tracing.OTLPEndpoint != "", "tracing.otlp_endpoint is required for the otlp exporter")
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be within [0, 1]")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level must be one of debug, info, warn, error, got %q", c.Log.Level)
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format must be json or text, got %q", c.Log.Format)
+
+	check(c.Stream.ReplaySize >= 0, "stream.replay_size must not be negative")
+	check(c.Stream.ClientBuffer > 0, "stream.client_buffer must be positive")
+	check(c.Stream.Heartbeat > 0, "stream.heartbeat must be positive")
+
+	check(c.Webhooks.PollInterval > 0, "webhooks.poll_interval must be positive")
+	check(c.Webhooks.BatchSize > 0, "webhooks.batch_size must be positive")
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive")
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+	check(c.Webhooks.RetryInitial > 0, "webhooks.retry_initial must be positive")
+	check(c.Webhooks.RetryMax >= c.Webhooks.RetryInitial, "webhooks.retry_max must be >= retry_initial")
+
+	check(c.Anomaly.MaxSale > 0 && c.Anomaly.MaxSale <= 100, "anomaly.max_sale must be within (0, 100]")
+	check(c.Anomaly.MaxPaymentSkew > 0, "anomaly.max_payment_skew must be positive")
+	check(c.Anomaly.MaxDeliveryRatio > 0, "anomaly.max_delivery_ratio must be positive")
+	check(c.Anomaly.MaxCustomersPerContact > 0, "anomaly.max_customers_per_contact must be positive")
+	check(c.Anomaly.BackfillInterval > 0, "anomaly.backfill_interval must be positive")
+
+	check(c.Outbox.PollInterval > 0, "outbox.poll_interval must be positive")
+	check(c.Outbox.BatchSize > 0, "outbox.batch_size must be positive")
+	check(c.Outbox.MaxAttempts > 0, "outbox.max_attempts must be positive")
+
+	_, err = time.LoadLocation(c.Timezone)
+	check(err == nil, "timezone %q is unknown", c.Timezone)
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+
+	return errs
+}
+
+// Location returns the validated timezone
+func (c *Config) Location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Print writes the config as YAML with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	out := *c
+	out.Kafka.Brokers = append([]string(nil), c.Kafka.Brokers...)
+	for _, s := range out.settings() {
+		if p, ok := s.ptr.(*string); ok && s.secret && *p != "" {
+			*p = redacted
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&out); err != nil {
+		return err
+	}
+	return enc.Close()
 }
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// required sets the settings that have no default
+func required(t *testing.T) {
+	t.Helper()
+	t.Setenv("POSTGRES_USER", "orders")
+	t.Setenv("POSTGRES_PASSWORD", "hunter2")
+	t.Setenv("POSTGRES_DB", "orders")
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	required(t)
+	path := writeFile(t, `
+kafka:
+  topic: file-topic
+  brokers: [file:9092]
+cache:
+  capacity: 200
+  warmup_timeout: 5s
+`)
+	t.Setenv("KAFKA_TOPIC", "env-topic")
+	t.Setenv("CACHE_CAPACITY", "300")
+
+	cfg, err := Load([]string{"--config", path, "--kafka.topic=flag-topic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		got, want any
+	}{
+		{"default", cfg.DB.Host, "localhost"},
+		{"file over default", cfg.Cache.WarmupTimeout, 5 * time.Second},
+		{"file list", strings.Join(cfg.Kafka.Brokers, ","), "file:9092"},
+		{"env over file", cfg.Cache.Capacity, 300},
+		{"flag over env", cfg.Kafka.Topic, "flag-topic"},
+	}
+	for _, tc := range cases {
+		if tc.got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	required(t)
+	path := writeFile(t, `
+kafka:
+  dlq_topic: orders
+cache:
+  capacity: 0
+`)
+	t.Setenv("POSTGRES_PORT", "port")
+
+	cfg, err := Load([]string{"--config", path, "--cache.warmup_timeout=soon", "--http.addr=", "--print-config"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	// The invalid config still comes back for --print-config
+	if cfg == nil || !cfg.PrintConfig || cfg.Kafka.DLQTopic != "orders" || cfg.DB.Port != "port" {
+		t.Fatalf("merged config not returned with the errors: %+v", cfg)
+	}
+	for _, want := range []string{
+		`flag --cache.warmup_timeout: invalid duration "soon"`,
+		`db.port must be a valid port, got "port"`,
+		"kafka.dlq_topic must differ from kafka.topic",
+		"cache.capacity must be positive",
+		"http.addr is required",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadUnknownFileKey(t *testing.T) {
+	required(t)
+	path := writeFile(t, "kafka:\n  topics: orders\n")
+
+	if _, err := Load([]string{"--config", path}); err == nil || !strings.Contains(err.Error(), "topics") {
+		t.Fatalf("expected an error naming the unknown key, got %v", err)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	required(t)
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, "password: '"+redacted+"'") {
+		t.Fatalf("password not redacted:\n%s", out)
+	}
+	if !strings.Contains(out, "user: orders") {
+		t.Fatalf("non-secret settings missing:\n%s", out)
+	}
+
+	// Printing leaves the config itself alone
+	if cfg.DB.Password != "hunter2" {
+		t.Fatalf("Print changed the password to %q", cfg.DB.Password)
+	}
+}
@@ -14,7 +14,7 @@ type DB struct {
 }
 
 func NewDB(ctx context.Context, cfg *config.Config) (*DB, error) {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s", cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName)
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s", cfg.DB.User, cfg.DB.Password, cfg.DB.Host, cfg.DB.Port, cfg.DB.Name)
 
 	pool, err := pgxpool.New(ctx, dsn)
 	if err != nil {
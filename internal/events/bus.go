@@ -0,0 +1,162 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/metrics"
+)
+
+// Policy decides what Publish does when a subscriber buffer is full
+type Policy int
+
+const (
+	// Drop the event for that subscriber, publishers never wait
+	Drop Policy = iota
+	// Block the publisher until the subscriber catches up or ctx is done
+	Block
+)
+
+func (p Policy) String() string {
+	if p == Block {
+		return "block"
+	}
+	return "drop"
+}
+
+type Bus struct {
+	seq atomic.Uint64
+
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives events of the requested types, all types when
+// none are given. Read Events until Done is closed
+type Subscription struct {
+	name   string
+	policy Policy
+	types  map[Type]bool
+	ch     chan Event
+	done   chan struct{}
+	once   sync.Once
+	bus    *Bus
+}
+
+// Subscribe registers a subscriber with its own buffer of the given size
+func (b *Bus) Subscribe(name string, buffer int, policy Policy, types ...Type) *Subscription {
+	s := &Subscription{
+		name:   name,
+		policy: policy,
+		ch:     make(chan Event, buffer),
+		done:   make(chan struct{}),
+		bus:    b,
+	}
+	if len(types) > 0 {
+		s.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		s.once.Do(func() { close(s.done) })
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+func (s *Subscription) Name() string { return s.name }
+
+func (s *Subscription) Events() <-chan Event { return s.ch }
+
+// Done is closed when the subscription or the whole bus is closed
+func (s *Subscription) Done() <-chan struct{} { return s.done }
+
+// Close unsubscribes. Events still buffered stay readable
+func (s *Subscription) Close() {
+	s.once.Do(func() { close(s.done) })
+
+	s.bus.mu.Lock()
+	delete(s.bus.subs, s)
+	s.bus.mu.Unlock()
+	metrics.EventQueueLength.DeleteLabelValues(s.name)
+}
+
+func (s *Subscription) wants(t Type) bool {
+	return s.types == nil || s.types[t]
+}
+
+// Publish stamps e with an ID and time and hands it to every matching
+// subscriber. ctx bounds how long Block subscribers can hold it up
+func (b *Bus) Publish(ctx context.Context, e Event) Event {
+	e.ID = b.seq.Add(1)
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	metrics.EventsPublished.WithLabelValues(string(e.Type)).Inc()
+
+	// Snapshot so a blocked subscriber does not hold the lock
+	b.mu.RLock()
+	subs := make([]*Subscription, 0, len(b.subs))
+	for s := range b.subs {
+		if s.wants(e.Type) {
+			subs = append(subs, s)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, s := range subs {
+		s.deliver(ctx, e)
+	}
+	return e
+}
+
+func (s *Subscription) deliver(ctx context.Context, e Event) {
+	delivered := false
+	if s.policy == Block {
+		select {
+		case s.ch <- e:
+			delivered = true
+		case <-s.done:
+		case <-ctx.Done():
+		}
+	} else {
+		select {
+		case s.ch <- e:
+			delivered = true
+		case <-s.done:
+		default:
+		}
+	}
+
+	if delivered {
+		metrics.EventsDelivered.WithLabelValues(s.name).Inc()
+	} else {
+		metrics.EventsDropped.WithLabelValues(s.name).Inc()
+	}
+	metrics.EventQueueLength.WithLabelValues(s.name).Set(float64(len(s.ch)))
+}
+
+// Close closes every subscription, later Publish calls reach nobody
+func (b *Bus) Close() {
+	b.mu.Lock()
+	subs := b.subs
+	b.subs = make(map[*Subscription]struct{})
+	b.closed = true
+	b.mu.Unlock()
+
+	for s := range subs {
+		s.once.Do(func() { close(s.done) })
+	}
+}
@@ -0,0 +1,62 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBusFiltersAndDrops(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+
+	all := bus.Subscribe("all", 1, Drop)
+	evicted := bus.Subscribe("evicted", 4, Drop, CacheEvicted)
+
+	ctx := context.Background()
+	bus.Publish(ctx, Event{Type: OrderPersisted, OrderUID: "o-1"})
+	bus.Publish(ctx, Event{Type: CacheEvicted, OrderUID: "o-2"})
+
+	// Buffer of one: the second event was dropped for "all"
+	if e := <-all.Events(); e.OrderUID != "o-1" || e.ID != 1 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	select {
+	case e := <-all.Events():
+		t.Fatalf("expected drop, got %+v", e)
+	default:
+	}
+
+	if e := <-evicted.Events(); e.Type != CacheEvicted || e.ID != 2 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
+
+func TestBusBlockWaitsForSubscriber(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+
+	sub := bus.Subscribe("slow", 0, Block)
+
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(context.Background(), Event{Type: OrderPersisted})
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("publish did not wait for a blocking subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-sub.Events()
+	<-published
+
+	// Closing the subscription releases a blocked publisher
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		sub.Close()
+	}()
+	bus.Publish(context.Background(), Event{Type: OrderPersisted})
+}
@@ -0,0 +1,53 @@
+// Package events is an in-process bus for order lifecycle events. The
+// consumer and the cache publish, webhooks, streams, the anomaly checker
+// and audit subscribe
+package events
+
+import (
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+type Type string
+
+const (
+	// Order stored in Postgres and cached
+	OrderPersisted Type = "order.persisted"
+	// Payload could not be decoded or failed validation
+	OrderRejected Type = "order.rejected"
+	// Valid order that could not be stored, moved to the DLQ
+	OrderDeadLettered Type = "order.dead_lettered"
+	// Order pushed out of the LRU cache
+	CacheEvicted Type = "cache.evicted"
+)
+
+// Types lists every event type, in a stable order
+var Types = []Type{OrderPersisted, OrderRejected, OrderDeadLettered, CacheEvicted}
+
+type Event struct {
+	// Sequence number assigned by the bus, increasing per process
+	ID       uint64    `json:"id"`
+	Type     Type      `json:"type"`
+	At       time.Time `json:"at"`
+	OrderUID string    `json:"order_uid,omitempty"`
+
+	SubmissionID string `json:"submission_id,omitempty"`
+	// DLQ stage and failure reason for rejected and dead-lettered orders
+	Stage  string `json:"stage,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	// Kafka position of the source message, if any
+	Partition *int   `json:"partition,omitempty"`
+	Offset    *int64 `json:"offset,omitempty"`
+
+	// Full order for OrderPersisted
+	Order *models.Order `json:"order,omitempty"`
+}
+
+// FromMessage fills the Kafka position of the source message
+func (e Event) FromMessage(partition int, offset int64) Event {
+	e.Partition = &partition
+	e.Offset = &offset
+	return e
+}
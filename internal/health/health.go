@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckFunc returns nil when the component can serve
+type CheckFunc func(ctx context.Context) error
+
+// ComponentStatus is one component in the /readyz report
+type ComponentStatus struct {
+	Status      string     `json:"status"`
+	LatencyMs   float64    `json:"latency_ms"`
+	Error       string     `json:"error,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+type lastError struct {
+	msg string
+	at  time.Time
+}
+
+// Checker runs readiness checks of all registered components
+type Checker struct {
+	timeout      time.Duration
+	checks       []check
+	shuttingDown atomic.Bool
+
+	mu   sync.Mutex
+	last map[string]lastError
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, last: make(map[string]lastError)}
+}
+
+// Add registers a component check. Not safe to call once serving
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// SetShuttingDown makes readiness fail so load balancers stop routing here
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Check runs all checks concurrently, each bounded by the checker timeout
+func (c *Checker) Check(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Components: make(map[string]ComponentStatus, len(c.checks)+1)}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ch := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st := c.run(ctx, ch)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[ch.name] = st
+			if st.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.shuttingDown.Load() {
+		report.Status = StatusFail
+		report.Components["shutdown"] = ComponentStatus{Status: StatusFail, Error: "shutting down"}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, ch check) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := ch.fn(ctx)
+	st := ComponentStatus{
+		Status:    StatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		st.Status = StatusFail
+		st.Error = err.Error()
+		c.last[ch.name] = lastError{msg: err.Error(), at: time.Now().UTC()}
+	}
+	if last, ok := c.last[ch.name]; ok {
+		st.LastError = last.msg
+		st.LastErrorAt = &last.at
+	}
+	return st
+}
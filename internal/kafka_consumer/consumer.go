@@ -3,24 +3,43 @@ package kafka_consumer
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/tmozzze/order_checker/internal/cache"
+	"github.com/tmozzze/order_checker/internal/events"
+	"github.com/tmozzze/order_checker/internal/logging"
+	"github.com/tmozzze/order_checker/internal/metrics"
 	"github.com/tmozzze/order_checker/internal/models"
 	"github.com/tmozzze/order_checker/internal/repository"
+	"github.com/tmozzze/order_checker/internal/tracing"
+	"github.com/tmozzze/order_checker/internal/validation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Consumer struct {
-	reader     *kafka.Reader
-	repo       *repository.OrderRepository
-	cache      *cache.Cache
-	processedC chan string
+	reader      *kafka.Reader
+	brokers     []string
+	groupID     string
+	repo        repository.OrderStore
+	submissions repository.SubmissionStore
+	cache       cache.OrderCache
+	dlq         *DeadLetterQueue
+	profiles    *validation.Profiles
+	retry       RetryPolicy
+	bus         *events.Bus
+	log         *slog.Logger
+
+	mu  sync.Mutex
+	lag map[int]int64 // partition -> messages behind high watermark
 }
 
 func NewConsumer(brokers []string, topic, groupID string,
-	repo *repository.OrderRepository, c *cache.Cache, processedC chan string) *Consumer {
+	repo repository.OrderStore, submissions repository.SubmissionStore, c cache.OrderCache, dlq *DeadLetterQueue, profiles *validation.Profiles, retry RetryPolicy, bus *events.Bus, logger *slog.Logger) *Consumer {
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:           brokers,
 		Topic:             topic,
@@ -33,19 +52,21 @@ func NewConsumer(brokers []string, topic, groupID string,
 		StartOffset:       kafka.FirstOffset,
 	})
 
-	return &Consumer{reader: r, repo: repo, cache: c, processedC: processedC}
+	return &Consumer{reader: r, brokers: brokers, groupID: groupID, lag: make(map[int]int64), repo: repo, submissions: submissions, cache: c, dlq: dlq, profiles: profiles, retry: retry, bus: bus, log: logger.With("component", "consumer")}
 }
 
+// Start consumes until ctx is cancelled. A message that is already being
+// processed is finished and committed before Start returns
 func (c *Consumer) Start(ctx context.Context) error {
-	log.Println("Kafka consumer started")
+	c.log.InfoContext(ctx, "kafka consumer started")
 
 	// Exit if ctx cancel
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Kafka consumer stopping...")
+			c.log.InfoContext(ctx, "kafka consumer stopping")
 			if err := c.reader.Close(); err != nil {
-				log.Printf("failed to close kafka reader: %v", err)
+				c.log.ErrorContext(ctx, "failed to close kafka reader", "error", err)
 			}
 			return nil
 		default:
@@ -54,43 +75,180 @@ func (c *Consumer) Start(ctx context.Context) error {
 		// Read message
 		m, err := c.reader.FetchMessage(ctx)
 		if err != nil {
-			log.Printf("failed to fetch message: %v", err)
+			if ctx.Err() != nil {
+				continue
+			}
+			c.log.ErrorContext(ctx, "failed to fetch message", "error", err)
 			time.Sleep(time.Second)
 			continue
 		}
 
-		log.Printf("got message at topic/partition/offset %v/%v/%v", m.Topic, m.Partition, m.Offset)
+		c.recordLag(m)
+		c.handleMessage(ctx, m)
+	}
+}
 
-		// Parsing order
-		var order models.Order
-		if err := json.Unmarshal(m.Value, &order); err != nil {
-			log.Printf("failed to unmarshal order: %v", err)
-			continue
+// handleMessage processes one message. ctx only signals shutdown: the
+// Postgres and Kafka calls use a context that is not cancelled with it,
+// so the message in flight is not interrupted halfway
+func (c *Consumer) handleMessage(ctx context.Context, m kafka.Message) {
+	defer func(start time.Time) {
+		metrics.ConsumerDuration.Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	ctx = logging.With(ctx,
+		slog.Int(logging.KeyPartition, m.Partition),
+		slog.Int64(logging.KeyOffset, m.Offset),
+	)
+	c.log.DebugContext(ctx, "got message", "topic", m.Topic)
+
+	// Continue the producer trace and link to the producer span
+	producerCtx := tracing.Extract(ctx, tracing.KafkaHeaders{Headers: &m.Headers})
+	ctx, span := tracing.Tracer().Start(producerCtx, "kafka.consume "+m.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.LinkFromContext(producerCtx)),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", m.Topic),
+			attribute.Int("messaging.kafka.destination.partition", m.Partition),
+			attribute.Int64("messaging.kafka.message.offset", m.Offset),
+		),
+	)
+	defer span.End()
+
+	// Parsing order
+	var order models.Order
+	if err := json.Unmarshal(m.Value, &order); err != nil {
+		tracing.RecordError(span, err)
+		c.log.WarnContext(ctx, "failed to unmarshal order", "error", err)
+		c.deadLetter(ctx, m, nil, StageDecode, err)
+		return
+	}
+
+	span.SetAttributes(attribute.String("order.uid", order.OrderUID))
+	ctx = logging.With(ctx, slog.String(logging.KeyOrderUID, order.OrderUID))
+
+	result := c.profiles.Select(order.Entry, m.Topic).Check(&order)
+	if err := result.Err(); err != nil {
+		tracing.RecordError(span, err)
+		c.log.WarnContext(ctx, "invalid order data", "profile", result.Profile, "error", err)
+		c.deadLetter(ctx, m, &order, StageValidate, err)
+		return
+	}
+	if len(result.Warnings) > 0 {
+		c.log.InfoContext(ctx, "order accepted with validation warnings", "profile", result.Profile, "warnings", result.Warnings)
+	}
+	order.Validation = result.Report()
+
+	// Saving to postgres, transient errors are retried with backoff
+	src := messageSource(m)
+	attempts, err := c.retry.retry(ctx, c.log, "save order", func(ctx context.Context) error {
+		return c.repo.SaveOrder(ctx, &order, src)
+	})
+	if err != nil {
+		tracing.RecordError(span, err)
+		if ctx.Err() != nil {
+			// Shutting down: leave the offset uncommitted for redelivery
+			return
 		}
+		c.log.ErrorContext(ctx, "failed to save order", "attempts", attempts, "error", err)
+		if IsTransient(err) {
+			err = fmt.Errorf("retries exhausted after %d attempts: %w", attempts, err)
+		}
+		c.deadLetter(ctx, m, &order, StagePersist, err)
+		return
+	}
 
-		if err := order.Validate(); err != nil {
-			log.Printf("Invalid order data: %v", err)
-			continue
+	procCtx := context.WithoutCancel(ctx)
+	c.updateSubmission(procCtx, m, models.SubmissionPersisted, "")
+	metrics.ConsumerProcessed.Inc()
+
+	// Cache
+	c.cache.Set(order.OrderUID, &order)
+	c.log.InfoContext(ctx, "order processed")
+
+	c.bus.Publish(ctx, events.Event{
+		Type:         events.OrderPersisted,
+		OrderUID:     order.OrderUID,
+		SubmissionID: header(m.Headers, models.SubmissionIDHeader),
+		Order:        &order,
+	}.FromMessage(m.Partition, m.Offset))
+
+	c.commitOffset(procCtx, m)
+}
+
+// deadLetter moves m to the DLQ and commits its offset. Consumption is
+// paused until the DLQ accepts the message so nothing is lost. order is
+// nil when the payload could not be decoded
+func (c *Consumer) deadLetter(ctx context.Context, m kafka.Message, order *models.Order, stage string, cause error) {
+	procCtx := context.WithoutCancel(ctx)
+	for {
+		err := c.dlq.Publish(procCtx, m, stage, cause)
+		if err == nil {
+			break
 		}
+		c.log.ErrorContext(ctx, "failed to publish message to DLQ", "error", err)
 
-		// Saving to postgres
-		if err := c.repo.SaveOrder(ctx, &order); err != nil {
-			log.Printf("failed to save order %s: %v", order.OrderUID, err)
-			continue
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
 		}
+	}
+
+	c.log.WarnContext(ctx, "message dead-lettered", "stage", stage, "cause", cause)
+	metrics.ConsumerFailed.WithLabelValues(stage).Inc()
 
-		// Cache
-		c.cache.Set(order.OrderUID, &order)
-		c.processedC <- order.OrderUID
-		log.Printf("order cached: %s", order.OrderUID)
+	// Bad payloads are rejected, good ones we failed to store are dead-lettered
+	status, event := models.SubmissionRejected, events.OrderRejected
+	if stage == StagePersist {
+		status, event = models.SubmissionDeadLettered, events.OrderDeadLettered
+	}
+	c.updateSubmission(procCtx, m, status, cause.Error())
+
+	uid := string(m.Key) // the relay keys every message by order_uid
+	if order != nil {
+		uid = order.OrderUID
+	}
+	c.bus.Publish(ctx, events.Event{
+		Type:         event,
+		OrderUID:     uid,
+		SubmissionID: header(m.Headers, models.SubmissionIDHeader),
+		Stage:        stage,
+		Reason:       cause.Error(),
+		Order:        order,
+	}.FromMessage(m.Partition, m.Offset))
+
+	c.commitOffset(procCtx, m)
+}
 
-		c.commitOffset(ctx, m)
+// messageSource tells the order history where m came from. Messages with
+// a submission were sent to POST /orders
+func messageSource(m kafka.Message) models.EventSource {
+	src := models.EventSource{Source: models.SourceKafka, Actor: "kafka:" + m.Topic}
+	if id := header(m.Headers, models.SubmissionIDHeader); id != "" {
+		src = models.EventSource{Source: models.SourceHTTP, Actor: "api", SubmissionID: id}
+		if actor := header(m.Headers, models.ActorHeader); actor != "" {
+			src.Actor = actor
+		}
+	}
+	return src.FromMessage(m.Topic, m.Partition, m.Offset)
+}
 
+// updateSubmission reports the outcome to the submission that produced m.
+// Messages not sent through POST /orders have no submission
+func (c *Consumer) updateSubmission(ctx context.Context, m kafka.Message, status, reason string) {
+	id := header(m.Headers, models.SubmissionIDHeader)
+	if id == "" {
+		return
+	}
+	if err := c.submissions.UpdateStatus(ctx, id, status, reason); err != nil {
+		c.log.ErrorContext(ctx, "failed to update submission", "submission_id", id, "status", status, "error", err)
 	}
 }
 
 func (c *Consumer) commitOffset(ctx context.Context, m kafka.Message) {
 	if err := c.reader.CommitMessages(ctx, m); err != nil {
-		log.Printf("failed to commit message offset: %v", err)
+		c.log.ErrorContext(ctx, "failed to commit message offset", "error", err)
 	}
 }
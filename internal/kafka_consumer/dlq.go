@@ -0,0 +1,268 @@
+package kafka_consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Processing stages a message can fail at
+const (
+	StageDecode   = "decode"
+	StageValidate = "validate"
+	StagePersist  = "persist"
+	StageApply    = "apply" // status update could not be applied
+)
+
+// Headers attached to dead-lettered messages
+const (
+	HeaderReason            = "x-dlq-reason"
+	HeaderStage             = "x-dlq-stage"
+	HeaderOriginalTopic     = "x-dlq-original-topic"
+	HeaderOriginalPartition = "x-dlq-original-partition"
+	HeaderOriginalOffset    = "x-dlq-original-offset"
+	HeaderAttempt           = "x-dlq-attempt"
+	HeaderFailedAt          = "x-dlq-failed-at"
+)
+
+const maxMessageBytes = 10e6
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a message stored in the DLQ topic
+type DeadLetter struct {
+	Partition         int       `json:"partition"`
+	Offset            int64     `json:"offset"`
+	Time              time.Time `json:"time"`
+	Key               string    `json:"key,omitempty"`
+	Value             string    `json:"value"`
+	Reason            string    `json:"reason"`
+	Stage             string    `json:"stage"`
+	OriginalTopic     string    `json:"original_topic"`
+	OriginalPartition int       `json:"original_partition"`
+	OriginalOffset    int64     `json:"original_offset"`
+	Attempt           int       `json:"attempt"`
+	FailedAt          string    `json:"failed_at"`
+}
+
+// DeadLetterQueue publishes failed messages to the DLQ topic and re-drives
+// them back to the source topic
+type DeadLetterQueue struct {
+	brokers     []string
+	topic       string
+	sourceTopic string
+	writer      *kafka.Writer
+	redrive     *kafka.Writer
+}
+
+func NewDeadLetterQueue(brokers []string, topic, sourceTopic string) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		brokers:     brokers,
+		topic:       topic,
+		sourceTopic: sourceTopic,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+		redrive: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        sourceTopic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+func (q *DeadLetterQueue) Topic() string {
+	return q.topic
+}
+
+// Publish sends m to the DLQ with the failure reason and its origin
+func (q *DeadLetterQueue) Publish(ctx context.Context, m kafka.Message, stage string, cause error) error {
+	// Messages re-driven from the DLQ carry their previous attempt count
+	attempt := 1
+	if v := header(m.Headers, HeaderAttempt); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			attempt = n + 1
+		}
+	}
+
+	headers := withoutDLQHeaders(m.Headers)
+	headers = append(headers,
+		kafka.Header{Key: HeaderReason, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderStage, Value: []byte(stage)},
+		kafka.Header{Key: HeaderOriginalTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: HeaderAttempt, Value: []byte(strconv.Itoa(attempt))},
+		kafka.Header{Key: HeaderFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+	)
+
+	return q.writer.WriteMessages(ctx, kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	})
+}
+
+// List returns up to limit latest dead letters of every DLQ partition
+func (q *DeadLetterQueue) List(ctx context.Context, limit int) ([]DeadLetter, error) {
+	partitions, err := q.partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var letters []DeadLetter
+	for _, p := range partitions {
+		conn, err := kafka.DialLeader(ctx, "tcp", q.brokers[0], q.topic, p)
+		if err != nil {
+			return nil, err
+		}
+
+		first, last, err := conn.ReadOffsets()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		from := max(first, last-int64(limit))
+		for offset := from; offset < last; offset++ {
+			m, err := readAt(ctx, conn, offset)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			letters = append(letters, toDeadLetter(m))
+		}
+		conn.Close()
+	}
+	return letters, nil
+}
+
+// Get returns one dead letter by its DLQ position
+func (q *DeadLetterQueue) Get(ctx context.Context, partition int, offset int64) (*DeadLetter, error) {
+	m, err := q.fetch(ctx, partition, offset)
+	if err != nil {
+		return nil, err
+	}
+	dl := toDeadLetter(m)
+	return &dl, nil
+}
+
+// Redrive publishes a dead letter back onto the source topic. The attempt
+// count is kept so a repeated failure is recorded as the next attempt
+func (q *DeadLetterQueue) Redrive(ctx context.Context, partition int, offset int64) error {
+	m, err := q.fetch(ctx, partition, offset)
+	if err != nil {
+		return err
+	}
+
+	headers := withoutDLQHeaders(m.Headers)
+	headers = append(headers, kafka.Header{Key: HeaderAttempt, Value: []byte(header(m.Headers, HeaderAttempt))})
+
+	return q.redrive.WriteMessages(ctx, kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	})
+}
+
+func (q *DeadLetterQueue) Close() error {
+	return errors.Join(q.writer.Close(), q.redrive.Close())
+}
+
+func (q *DeadLetterQueue) fetch(ctx context.Context, partition int, offset int64) (kafka.Message, error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", q.brokers[0], q.topic, partition)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	defer conn.Close()
+
+	first, last, err := conn.ReadOffsets()
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	if offset < first || offset >= last {
+		return kafka.Message{}, ErrDeadLetterNotFound
+	}
+
+	return readAt(ctx, conn, offset)
+}
+
+func (q *DeadLetterQueue) partitions(ctx context.Context) ([]int, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", q.brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	parts, err := conn.ReadPartitions(q.topic)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(parts))
+	for _, p := range parts {
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
+
+func readAt(ctx context.Context, conn *kafka.Conn, offset int64) (kafka.Message, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	} else {
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	}
+
+	if _, err := conn.Seek(offset, kafka.SeekAbsolute); err != nil {
+		return kafka.Message{}, fmt.Errorf("seek to offset %d: %w", offset, err)
+	}
+	return conn.ReadMessage(maxMessageBytes)
+}
+
+func toDeadLetter(m kafka.Message) DeadLetter {
+	dl := DeadLetter{
+		Partition:     m.Partition,
+		Offset:        m.Offset,
+		Time:          m.Time,
+		Key:           string(m.Key),
+		Value:         string(m.Value),
+		Reason:        header(m.Headers, HeaderReason),
+		Stage:         header(m.Headers, HeaderStage),
+		OriginalTopic: header(m.Headers, HeaderOriginalTopic),
+		FailedAt:      header(m.Headers, HeaderFailedAt),
+	}
+	dl.OriginalPartition, _ = strconv.Atoi(header(m.Headers, HeaderOriginalPartition))
+	dl.OriginalOffset, _ = strconv.ParseInt(header(m.Headers, HeaderOriginalOffset), 10, 64)
+	dl.Attempt, _ = strconv.Atoi(header(m.Headers, HeaderAttempt))
+	return dl
+}
+
+func header(headers []kafka.Header, key string) string {
+	for _, h := range headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func withoutDLQHeaders(headers []kafka.Header) []kafka.Header {
+	out := make([]kafka.Header, 0, len(headers))
+	for _, h := range headers {
+		switch h.Key {
+		case HeaderReason, HeaderStage, HeaderOriginalTopic, HeaderOriginalPartition,
+			HeaderOriginalOffset, HeaderAttempt, HeaderFailedAt:
+			continue
+		}
+		out = append(out, h)
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package kafka_consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/tmozzze/order_checker/internal/metrics"
+)
+
+// PingBrokers succeeds if at least one broker accepts a connection
+func PingBrokers(ctx context.Context, brokers []string) error {
+	var errs []error
+	for _, b := range brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", b)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Consumer) recordLag(m kafka.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lag := max(m.HighWaterMark-m.Offset-1, 0)
+	c.lag[m.Partition] = lag
+	metrics.ConsumerLag.WithLabelValues(strconv.Itoa(m.Partition)).Set(float64(lag))
+}
+
+// Lag returns the last seen lag of every partition this consumer read
+func (c *Consumer) Lag() map[int]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lag := make(map[int]int64, len(c.lag))
+	for p, l := range c.lag {
+		lag[p] = l
+	}
+	return lag
+}
+
+// CheckHealth verifies the consumer group is stable with members and the
+// total lag is within maxLag (0 disables the lag check)
+func (c *Consumer) CheckHealth(ctx context.Context, maxLag int64) error {
+	client := &kafka.Client{Addr: kafka.TCP(c.brokers...)}
+
+	resp, err := client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{c.groupID}})
+	if err != nil {
+		return fmt.Errorf("describe group: %w", err)
+	}
+	if len(resp.Groups) == 0 {
+		return fmt.Errorf("group %s not found", c.groupID)
+	}
+
+	g := resp.Groups[0]
+	if g.Error != nil {
+		return fmt.Errorf("group %s: %w", c.groupID, g.Error)
+	}
+	if len(g.Members) == 0 {
+		return fmt.Errorf("group %s has no members (state %s)", c.groupID, g.GroupState)
+	}
+	if g.GroupState != "Stable" {
+		return fmt.Errorf("group %s is %s", c.groupID, g.GroupState)
+	}
+
+	if maxLag > 0 {
+		var total int64
+		for _, l := range c.Lag() {
+			total += l
+		}
+		if total > maxLag {
+			return fmt.Errorf("lag %d exceeds %d", total, maxLag)
+		}
+	}
+	return nil
+}
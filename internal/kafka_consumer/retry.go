@@ -0,0 +1,96 @@
+package kafka_consumer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+// RetryPolicy is a capped exponential backoff with jitter
+type RetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	MaxAttempts     int
+	AttemptTimeout  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	InitialInterval: 200 * time.Millisecond,
+	MaxInterval:     30 * time.Second,
+	Multiplier:      2,
+	MaxAttempts:     10,
+	AttemptTimeout:  10 * time.Second,
+}
+
+// Backoff returns the delay before the given retry (1-based).
+// Equal jitter: half of the interval is fixed, half is random
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.InitialInterval)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+		if d >= float64(p.MaxInterval) {
+			d = float64(p.MaxInterval)
+			break
+		}
+	}
+	half := time.Duration(d / 2)
+	return half + rand.N(half+1)
+}
+
+// IsTransient reports whether err is worth retrying: lost connections,
+// serialization failures, deadlocks and pool exhaustion. Constraint
+// violations and other data errors are permanent
+func IsTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == "40001" || // serialization_failure
+		pgErr.Code == "40P01") { // deadlock_detected
+		return true
+	}
+	return repository.IsUnavailable(err)
+}
+
+// retry runs fn until it succeeds, fails permanently or attempts run out.
+// It blocks the caller between attempts, which pauses consumption.
+// Cancelling ctx stops further attempts but lets the running one finish
+func (p RetryPolicy) retry(ctx context.Context, logger *slog.Logger, name string, fn func(ctx context.Context) error) (int, error) {
+	return p.retryIf(ctx, logger, name, IsTransient, fn)
+}
+
+// retryIf is retry with its own idea of which errors are worth retrying
+func (p RetryPolicy) retryIf(ctx context.Context, logger *slog.Logger, name string, retryable func(error) bool, fn func(ctx context.Context) error) (int, error) {
+	var err error
+	attempt := 0
+	for {
+		attempt++
+
+		attemptCtx := context.WithoutCancel(ctx)
+		cancel := func() {}
+		if p.AttemptTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(attemptCtx, p.AttemptTimeout)
+		}
+		err = fn(attemptCtx)
+		cancel()
+
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return attempt, err
+		}
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return attempt, err
+		}
+
+		delay := p.Backoff(attempt)
+		logger.WarnContext(ctx, name+" failed, retrying", "attempt", attempt, "delay", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
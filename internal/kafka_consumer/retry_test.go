@@ -0,0 +1,153 @@
+package kafka_consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/tmozzze/order_checker/internal/apperr"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestIsTransient(t *testing.T) {
+	pgErr := func(code string) error {
+		return fmt.Errorf("save order: %w", &pgconn.PgError{Code: code})
+	}
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", pgErr("40001"), true},
+		{"deadlock", pgErr("40P01"), true},
+		{"connection failure", pgErr("08006"), true},
+		{"too many connections", pgErr("53300"), true},
+		{"unique violation", pgErr("23505"), false},
+		{"check violation", pgErr("23514"), false},
+		{"connect error", &pgconn.ConnectError{}, true},
+		{"pool acquire timeout", fmt.Errorf("acquire: %w", context.DeadlineExceeded), true},
+		{"cancelled", fmt.Errorf("acquire: %w", context.Canceled), false},
+		{"unavailable", apperr.Errorf(apperr.ErrUnavailable, "db down"), true},
+		{"not found", apperr.Errorf(apperr.ErrNotFound, "order not found"), false},
+		{"plain", errors.New("boom"), false},
+		{"nil", nil, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsTransient(tc.err); got != tc.want {
+				t.Fatalf("IsTransient(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2}
+	cases := []struct {
+		attempt int
+		full    time.Duration // interval before jitter
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+	for _, tc := range cases {
+		for range 100 {
+			if d := p.Backoff(tc.attempt); d < tc.full/2 || d > tc.full {
+				t.Fatalf("Backoff(%d) = %v, want between %v and %v", tc.attempt, d, tc.full/2, tc.full)
+			}
+		}
+	}
+}
+
+func TestRetryStopsAtMaxAttempts(t *testing.T) {
+	p := RetryPolicy{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, Multiplier: 2, MaxAttempts: 3}
+	transient := &pgconn.PgError{Code: "40001"}
+
+	calls := 0
+	attempts, err := p.retry(context.Background(), discard, "test", func(ctx context.Context) error {
+		calls++
+		return transient
+	})
+	if attempts != 3 || calls != 3 || !errors.Is(err, transient) {
+		t.Fatalf("attempts %d, calls %d, err %v", attempts, calls, err)
+	}
+
+	// Permanent errors are not retried
+	calls = 0
+	permanent := &pgconn.PgError{Code: "23505"}
+	attempts, err = p.retry(context.Background(), discard, "test", func(ctx context.Context) error {
+		calls++
+		return permanent
+	})
+	if attempts != 1 || calls != 1 || !errors.Is(err, permanent) {
+		t.Fatalf("permanent: attempts %d, calls %d, err %v", attempts, calls, err)
+	}
+
+	// Success after a transient failure
+	calls = 0
+	attempts, err = p.retry(context.Background(), discard, "test", func(ctx context.Context) error {
+		if calls++; calls < 2 {
+			return transient
+		}
+		return nil
+	})
+	if attempts != 2 || err != nil {
+		t.Fatalf("recovered: attempts %d, err %v", attempts, err)
+	}
+}
+
+func TestRetryStopsOnCancel(t *testing.T) {
+	p := RetryPolicy{InitialInterval: time.Hour, MaxInterval: time.Hour, Multiplier: 2}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var attemptErr error
+	done := make(chan struct{})
+	var attempts int
+	var err error
+	go func() {
+		defer close(done)
+		attempts, err = p.retry(ctx, discard, "test", func(ctx context.Context) error {
+			attemptErr = ctx.Err()
+			return &pgconn.PgError{Code: "40001"}
+		})
+	}()
+
+	// The first attempt fails and the hour-long backoff is cut short
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("retry did not stop on cancel")
+	}
+	if attempts != 1 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("attempts %d, err %v", attempts, err)
+	}
+	if attemptErr != nil {
+		t.Fatalf("attempt ran with a cancelled context: %v", attemptErr)
+	}
+
+	// A cancel during an attempt lets it finish, no retry follows
+	ctx, cancel = context.WithCancel(context.Background())
+	calls := 0
+	attempts, err = p.retry(ctx, discard, "test", func(attemptCtx context.Context) error {
+		calls++
+		cancel()
+		if attemptCtx.Err() != nil {
+			t.Error("attempt context cancelled with the caller's")
+		}
+		return &pgconn.PgError{Code: "40001"}
+	})
+	if attempts != 1 || calls != 1 || err == nil {
+		t.Fatalf("cancel in attempt: attempts %d, calls %d, err %v", attempts, calls, err)
+	}
+}
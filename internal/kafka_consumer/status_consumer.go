@@ -0,0 +1,159 @@
+package kafka_consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/logging"
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+// StatusUpdate is a status-update message, keyed by order_uid so updates
+// of one order stay in order
+type StatusUpdate struct {
+	OrderUID string             `json:"order_uid"`
+	Status   models.OrderStatus `json:"status"`
+	Actor    string             `json:"actor"`
+	Reason   string             `json:"reason"`
+}
+
+// StatusChanger applies transitions, implemented by service.OrderService
+type StatusChanger interface {
+	ChangeStatus(ctx context.Context, orderUID string, to models.OrderStatus, src models.EventSource, reason string) (*models.StatusChange, error)
+}
+
+// StatusConsumer applies status updates from their own topic. Transient
+// database errors are retried, and so is an unknown order: the topic is not
+// ordered against the orders topic, an update may come before its order.
+// Updates that still fail go to their own DLQ
+type StatusConsumer struct {
+	reader *kafka.Reader
+	topic  string
+	svc    StatusChanger
+	dlq    *DeadLetterQueue
+	retry  RetryPolicy
+	log    *slog.Logger
+}
+
+func NewStatusConsumer(brokers []string, topic, groupID string, svc StatusChanger, dlq *DeadLetterQueue, retry RetryPolicy, logger *slog.Logger) *StatusConsumer {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:           brokers,
+		Topic:             topic,
+		GroupID:           groupID,
+		MinBytes:          1,
+		MaxBytes:          10e6,
+		HeartbeatInterval: 3 * time.Second,
+		SessionTimeout:    30 * time.Second,
+		CommitInterval:    time.Second,
+		StartOffset:       kafka.FirstOffset,
+	})
+
+	return &StatusConsumer{reader: r, topic: topic, svc: svc, dlq: dlq, retry: retry, log: logger.With("component", "status_consumer")}
+}
+
+// Start consumes until ctx is cancelled, finishing the message in flight
+func (c *StatusConsumer) Start(ctx context.Context) error {
+	c.log.InfoContext(ctx, "status consumer started", "topic", c.topic)
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := c.reader.Close(); err != nil {
+				c.log.ErrorContext(ctx, "failed to close kafka reader", "error", err)
+			}
+			return nil
+		default:
+		}
+
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			c.log.ErrorContext(ctx, "failed to fetch message", "error", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		c.handleMessage(ctx, m)
+	}
+}
+
+func (c *StatusConsumer) handleMessage(ctx context.Context, m kafka.Message) {
+	ctx = logging.With(ctx,
+		slog.Int(logging.KeyPartition, m.Partition),
+		slog.Int64(logging.KeyOffset, m.Offset),
+	)
+
+	var u StatusUpdate
+	if err := json.Unmarshal(m.Value, &u); err != nil || u.OrderUID == "" {
+		if err == nil {
+			err = errors.New("order_uid is required")
+		}
+		c.log.WarnContext(ctx, "malformed status update", "error", err)
+		c.deadLetter(ctx, m, StageDecode, err)
+		return
+	}
+	ctx = logging.With(ctx, slog.String(logging.KeyOrderUID, u.OrderUID))
+	if u.Actor == "" {
+		u.Actor = "kafka:" + c.topic
+	}
+	src := models.EventSource{Source: models.SourceKafka, Actor: u.Actor}.FromMessage(m.Topic, m.Partition, m.Offset)
+
+	attempts, err := c.retry.retryIf(ctx, c.log, "change status", retryStatusUpdate, func(ctx context.Context) error {
+		_, err := c.svc.ChangeStatus(ctx, u.OrderUID, u.Status, src, u.Reason)
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			// Shutting down: leave the offset uncommitted for redelivery
+			return
+		}
+		// The service already logged why
+		if retryStatusUpdate(err) {
+			err = fmt.Errorf("retries exhausted after %d attempts: %w", attempts, err)
+		}
+		c.deadLetter(ctx, m, StageApply, err)
+		return
+	}
+
+	c.commit(ctx, m)
+}
+
+// retryStatusUpdate also retries an unknown order, it may not be stored yet
+func retryStatusUpdate(err error) bool {
+	return IsTransient(err) || errors.Is(err, apperr.ErrNotFound)
+}
+
+// deadLetter moves m to the DLQ and commits its offset, pausing
+// consumption until the DLQ accepts it
+func (c *StatusConsumer) deadLetter(ctx context.Context, m kafka.Message, stage string, cause error) {
+	for {
+		err := c.dlq.Publish(context.WithoutCancel(ctx), m, stage, cause)
+		if err == nil {
+			break
+		}
+		c.log.ErrorContext(ctx, "failed to publish status update to DLQ", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+
+	c.log.WarnContext(ctx, "status update dead-lettered", "stage", stage, "cause", cause)
+	c.commit(ctx, m)
+}
+
+func (c *StatusConsumer) commit(ctx context.Context, m kafka.Message) {
+	if err := c.reader.CommitMessages(context.WithoutCancel(ctx), m); err != nil {
+		c.log.ErrorContext(ctx, "failed to commit message offset", "error", err)
+	}
+}
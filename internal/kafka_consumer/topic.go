@@ -2,13 +2,13 @@ package kafka_consumer
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 )
 
-func EnsureTopic(broker, topic string, partitions int, replicationFactor int) error {
+func EnsureTopic(broker, topic string, partitions int, replicationFactor int, logger *slog.Logger) error {
 	conn, err := kafka.Dial("tcp", broker)
 	if err != nil {
 		return err
@@ -29,7 +29,7 @@ func EnsureTopic(broker, topic string, partitions int, replicationFactor int) er
 		return err
 	}
 
-	log.Printf("Topic %s ensured", topic)
+	logger.Info("topic ensured", "topic", topic)
 	return nil
 
 }
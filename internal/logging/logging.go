@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Field names shared by every log line
+const (
+	KeyRequestID = "request_id"
+	KeyOrderUID  = "order_uid"
+	KeyPartition = "kafka_partition"
+	KeyOffset    = "kafka_offset"
+	KeyTraceID   = "trace_id"
+	KeySpanID    = "span_id"
+)
+
+const redacted = "[REDACTED]"
+
+// PII keys masked wherever they appear, nested groups included
+var piiKeys = map[string]bool{
+	"phone":   true,
+	"email":   true,
+	"address": true,
+}
+
+type Config struct {
+	Level  string // debug, info, warn, error
+	Format string // json, text
+}
+
+// New builds the app logger. The returned LevelVar changes the level at runtime
+func New(w io.Writer, cfg Config) (*slog.Logger, *slog.LevelVar, error) {
+	level := new(slog.LevelVar)
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, nil, fmt.Errorf("log level: %w", err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+
+	var h slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	return slog.New(&contextHandler{Handler: h}), level, nil
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if piiKeys[strings.ToLower(a.Key)] && a.Value.String() != "" {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+type ctxKey struct{}
+
+// With returns ctx carrying attrs that every *Context log call adds,
+// e.g. request_id in HTTP handlers or order_uid in the consumer
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(prev)+len(attrs))
+	merged = append(merged, prev...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, ctxKey{}, merged)
+}
+
+// contextHandler adds attrs stored by With plus trace and span ids
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(ctxKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String(KeyTraceID, sc.TraceID().String()),
+			slog.String(KeySpanID, sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+func TestContextFieldsAndRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger, level, err := New(&buf, Config{Level: "info", Format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := With(context.Background(), slog.String(KeyRequestID, "req-1"))
+	ctx = With(ctx, slog.String(KeyOrderUID, "o-1"))
+
+	d := models.Delivery{Name: "Test", Phone: "+9720000000", City: "Kiryat Mozkin", Address: "Ploshad Mira 15", Email: "test@gmail.com"}
+	logger.InfoContext(ctx, "saved", "delivery", d, "email", "leak@example.com")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line[KeyRequestID] != "req-1" || line[KeyOrderUID] != "o-1" {
+		t.Fatalf("context fields missing: %v", line)
+	}
+	if line["email"] != redacted {
+		t.Fatalf("top-level email not redacted: %v", line["email"])
+	}
+	delivery := line["delivery"].(map[string]any)
+	for _, k := range []string{"phone", "address", "email"} {
+		if delivery[k] != redacted {
+			t.Fatalf("delivery.%s not redacted: %v", k, delivery[k])
+		}
+	}
+	if delivery["city"] != d.City {
+		t.Fatalf("delivery.city should stay, got %v", delivery["city"])
+	}
+
+	// Runtime level change
+	buf.Reset()
+	logger.DebugContext(ctx, "hidden")
+	if buf.Len() != 0 {
+		t.Fatal("debug logged at info level")
+	}
+	level.Set(slog.LevelDebug)
+	logger.DebugContext(ctx, "shown")
+	if buf.Len() == 0 {
+		t.Fatal("debug not logged after level change")
+	}
+}
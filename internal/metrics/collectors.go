@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tmozzze/order_checker/internal/cache"
+)
+
+func desc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, nil)
+}
+
+// CacheCollector reads cache.Stats on every scrape
+type CacheCollector struct {
+	cache cache.OrderCache
+
+	hits, misses, evictions, size, capacity *prometheus.Desc
+}
+
+func NewCacheCollector(c cache.OrderCache) *CacheCollector {
+	return &CacheCollector{
+		cache:     c,
+		hits:      desc("cache_hits_total", "Cache lookups that found the order."),
+		misses:    desc("cache_misses_total", "Cache lookups that missed."),
+		evictions: desc("cache_evictions_total", "Orders evicted by the LRU policy."),
+		size:      desc("cache_size", "Orders currently cached."),
+		capacity:  desc("cache_capacity", "Cache capacity."),
+	}
+}
+
+func (c *CacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evictions
+	ch <- c.size
+	ch <- c.capacity
+}
+
+func (c *CacheCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(s.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, float64(s.Size))
+	ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(s.Capacity))
+}
+
+// PoolStats is what PoolCollector needs from pgxpool
+type PoolStats interface {
+	Stat() *pgxpool.Stat
+}
+
+// PoolCollector reads pgxpool.Stat on every scrape
+type PoolCollector struct {
+	pool PoolStats
+
+	acquired, idle, total, maxConns            *prometheus.Desc
+	acquires, acquireDuration, empty, canceled *prometheus.Desc
+}
+
+func NewPoolCollector(pool PoolStats) *PoolCollector {
+	return &PoolCollector{
+		pool:            pool,
+		acquired:        desc("pgxpool_acquired_conns", "Connections currently in use."),
+		idle:            desc("pgxpool_idle_conns", "Idle connections."),
+		total:           desc("pgxpool_total_conns", "All open connections."),
+		maxConns:        desc("pgxpool_max_conns", "Pool size limit."),
+		acquires:        desc("pgxpool_acquire_total", "Successful connection acquires."),
+		acquireDuration: desc("pgxpool_acquire_duration_seconds_total", "Total time spent acquiring connections."),
+		empty:           desc("pgxpool_empty_acquire_total", "Acquires that had to wait for a connection."),
+		canceled:        desc("pgxpool_canceled_acquire_total", "Acquires cancelled by their context."),
+	}
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.total
+	ch <- c.maxConns
+	ch <- c.acquires
+	ch <- c.acquireDuration
+	ch <- c.empty
+	ch <- c.canceled
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.empty, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceled, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+}
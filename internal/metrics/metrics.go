@@ -0,0 +1,210 @@
+// Package metrics exposes Prometheus metrics of the service.
+//
+// HTTP:
+//
+//	order_checker_http_requests_total{route,method,status}            counter
+//	order_checker_http_request_duration_seconds{route,method}         histogram
+//
+// Cache:
+//
+//	order_checker_cache_hits_total                                    counter
+//	order_checker_cache_misses_total                                  counter
+//	order_checker_cache_evictions_total                               counter
+//	order_checker_cache_size                                          gauge
+//	order_checker_cache_capacity                                      gauge
+//
+// Kafka consumer:
+//
+//	order_checker_consumer_messages_processed_total                   counter
+//	order_checker_consumer_messages_failed_total{stage}               counter
+//	order_checker_consumer_processing_duration_seconds                histogram
+//	order_checker_consumer_lag{partition}                             gauge
+//
+// Event bus:
+//
+//	order_checker_events_published_total{type}                        counter
+//	order_checker_events_delivered_total{subscriber}                  counter
+//	order_checker_events_dropped_total{subscriber}                    counter
+//	order_checker_event_subscriber_queue_length{subscriber}           gauge
+//
+// Order status:
+//
+//	order_checker_status_transitions_total{result}                    counter
+//
+// Webhooks:
+//
+//	order_checker_webhook_deliveries_total{result}                    counter
+//
+// Anomaly checker:
+//
+//	order_checker_order_findings_total{rule,severity}                 counter
+//
+// Repository:
+//
+//	order_checker_repository_query_duration_seconds{method}           histogram
+//
+// Postgres pool (pgxpool.Stat):
+//
+//	order_checker_pgxpool_acquired_conns                              gauge
+//	order_checker_pgxpool_idle_conns                                  gauge
+//	order_checker_pgxpool_total_conns                                 gauge
+//	order_checker_pgxpool_max_conns                                   gauge
+//	order_checker_pgxpool_acquire_total                               counter
+//	order_checker_pgxpool_acquire_duration_seconds_total              counter
+//	order_checker_pgxpool_empty_acquire_total                         counter
+//	order_checker_pgxpool_canceled_acquire_total                      counter
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "order_checker"
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	ConsumerProcessed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "consumer_messages_processed_total",
+		Help:      "Kafka messages persisted by the consumer.",
+	})
+
+	ConsumerFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "consumer_messages_failed_total",
+		Help:      "Kafka messages the consumer failed, by stage (decode, validate, persist).",
+	}, []string{"stage"})
+
+	ConsumerDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "consumer_processing_duration_seconds",
+		Help:      "Time to process one Kafka message, retries included.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	ConsumerLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "consumer_lag",
+		Help:      "Messages behind the high watermark, by partition.",
+	}, []string{"partition"})
+
+	EventsPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_published_total",
+		Help:      "Events published on the bus, by type.",
+	}, []string{"type"})
+
+	EventsDelivered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_delivered_total",
+		Help:      "Events queued for a subscriber.",
+	}, []string{"subscriber"})
+
+	EventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_dropped_total",
+		Help:      "Events a subscriber missed because its buffer was full or it was closing.",
+	}, []string{"subscriber"})
+
+	EventQueueLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_subscriber_queue_length",
+		Help:      "Events buffered and not yet read, by subscriber.",
+	}, []string{"subscriber"})
+
+	StatusTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_transitions_total",
+		Help:      "Order status change requests by result (applied, rejected, failed).",
+	}, []string{"result"})
+
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by result (delivered, retry, dead).",
+	}, []string{"result"})
+
+	OrderFindings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "order_findings_total",
+		Help:      "New anomaly checker findings by rule and severity, re-checks finding the same again are not counted.",
+	}, []string{"rule", "severity"})
+
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_query_duration_seconds",
+		Help:      "Repository call latency by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+// Register adds the app metrics plus Go and process collectors to reg
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		HTTPRequests, HTTPDuration,
+		ConsumerProcessed, ConsumerFailed, ConsumerDuration, ConsumerLag,
+		EventsPublished, EventsDelivered, EventsDropped, EventQueueLength,
+		StatusTransitions, WebhookDeliveries, OrderFindings,
+		QueryDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+}
+
+// ObserveQuery records a repository call, use as
+// defer metrics.ObserveQuery("GetOrderById", time.Now())
+func ObserveQuery(method string, start time.Time) {
+	QueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// Middleware records HTTP metrics labelled by the chi route pattern,
+// so /orders/{id} is one series instead of one per order
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,300 @@
+// Package migrate applies versioned SQL migrations to Postgres. Applied
+// versions are kept in schema_migrations with a checksum of their up
+// script, a session advisory lock keeps several instances from migrating
+// at once
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Advisory lock key, any constant shared by every instance works
+const lockKey = 72_616_153
+
+var ErrChecksumMismatch = errors.New("applied migration was modified")
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up
+}
+
+// Status of one migration. Known is false for versions found in the
+// database but not in this binary
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Known     bool       `json:"known"`
+	Modified  bool       `json:"modified"`
+}
+
+type applied struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+	log        *slog.Logger
+}
+
+func New(pool *pgxpool.Pool, fsys fs.FS, logger *slog.Logger) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{pool: pool, migrations: migrations, log: logger.With("component", "migrate")}, nil
+}
+
+// Load reads NNNN_name.up.sql and NNNN_name.down.sql pairs from the root
+// of fsys, sorted by version. Every migration needs both files
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down scripts", mig.Version, mig.Name)
+		}
+		sum := sha256.Sum256([]byte(mig.Up))
+		mig.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies every pending migration, each in its own transaction.
+// Returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(conn *pgx.Conn, done map[int64]applied) error {
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			start := time.Now()
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `
+					INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)
+				`, mig.Version, mig.Name, mig.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			m.log.InfoContext(ctx, "migration applied", "version", mig.Version, "name", mig.Name, "duration", time.Since(start))
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Down rolls back the last steps applied migrations, newest first.
+// Returns how many were rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(conn *pgx.Conn, done map[int64]applied) error {
+		for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			m.log.InfoContext(ctx, "migration rolled back", "version", mig.Version, "name", mig.Name)
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Status lists every migration known to the binary or the database,
+// by version. Unlike Up and Down it reports modified migrations instead
+// of failing
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	if err := ensureTable(ctx, conn.Conn()); err != nil {
+		return nil, err
+	}
+	done, err := loadApplied(ctx, conn.Conn())
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Status
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name, Known: true}
+		if a, ok := done[mig.Version]; ok {
+			s.Applied, s.AppliedAt = true, &a.appliedAt
+			s.Modified = a.checksum != mig.Checksum
+			delete(done, mig.Version)
+		}
+		out = append(out, s)
+	}
+	for version, a := range done {
+		out = append(out, Status{Version: version, Name: a.name, Applied: true, AppliedAt: &a.appliedAt})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// locked runs fn on one connection holding the migration lock, after
+// verifying the checksums of applied migrations
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgx.Conn, done map[int64]applied) error) error {
+	pc, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer pc.Release()
+	conn := pc.Conn()
+
+	start := time.Now()
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// The lock goes with the session, unlock even if ctx is done
+		if _, err := conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			m.log.ErrorContext(ctx, "failed to release migration lock", "error", err)
+		}
+	}()
+	if wait := time.Since(start); wait > time.Second {
+		m.log.InfoContext(ctx, "waited for migration lock", "duration", wait)
+	}
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	done, err := loadApplied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if err := m.verify(ctx, done); err != nil {
+		return err
+	}
+	return fn(conn, done)
+}
+
+// verify fails on applied migrations whose script changed since. Versions
+// unknown to the binary come from a newer release and are only logged
+func (m *Migrator) verify(ctx context.Context, done map[int64]applied) error {
+	known := make(map[int64]bool, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+		a, ok := done[mig.Version]
+		if ok && a.checksum != mig.Checksum {
+			return fmt.Errorf("%w: %d_%s, applied checksum %s, embedded %s",
+				ErrChecksumMismatch, mig.Version, mig.Name, a.checksum, mig.Checksum)
+		}
+	}
+	for version, a := range done {
+		if !known[version] {
+			m.log.WarnContext(ctx, "database has a migration this binary does not know", "version", version, "name", a.name)
+		}
+	}
+	return nil
+}
+
+func ensureTable(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	return err
+}
+
+func loadApplied(ctx context.Context, conn *pgx.Conn) (map[int64]applied, error) {
+	rows, err := conn.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int64]applied)
+	for rows.Next() {
+		var version int64
+		var a applied
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = a
+	}
+	return done, rows.Err()
+}
@@ -0,0 +1,162 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tmozzze/order_checker/database/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+		"0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"migrations.go":        {Data: []byte("package migrations")},
+	}
+
+	got, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Version != 1 || got[1].Version != 2 || got[0].Name != "first" {
+		t.Fatalf("unexpected migrations %+v", got)
+	}
+	if got[0].Checksum == "" || got[0].Checksum == got[1].Checksum {
+		t.Fatalf("bad checksums %q, %q", got[0].Checksum, got[1].Checksum)
+	}
+
+	delete(fsys, "0002_second.down.sql")
+	if _, err := Load(fsys); err == nil {
+		t.Fatal("expected error for migration without down script")
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	got, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range got {
+		if m.Version != int64(i+1) {
+			t.Fatalf("migration versions must be 1..n without gaps, got %d at %d", m.Version, i)
+		}
+	}
+}
+
+// Applies every migration to a scratch database created next to the one
+// in TEST_DATABASE_URL and initialised by the old init.sql, rolls them back
+// and applies them again
+func TestMigrateScratchDatabase(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	pool := scratchDatabase(t, dsn)
+
+	// Databases deployed before migrations were created by init.sql
+	initSQL, err := os.ReadFile("testdata/init.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, string(initSQL)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, `INSERT INTO orders (order_uid, customer_id) VALUES ('old', 'c')`); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m, err := New(pool, migrations.FS, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(m.migrations) {
+		t.Fatalf("applied %d of %d migrations", n, len(m.migrations))
+	}
+	if n, err := m.Up(ctx); err != nil || n != 0 {
+		t.Fatalf("second up: applied %d, err %v", n, err)
+	}
+
+	// Columns init.sql lacked are added, existing rows get the defaults
+	var hash *string
+	var orderStatus string
+	if err := pool.QueryRow(ctx, `SELECT payload_hash, status FROM orders WHERE order_uid = 'old'`).Scan(&hash, &orderStatus); err != nil {
+		t.Fatal(err)
+	}
+	if hash != nil || orderStatus != "created" {
+		t.Fatalf("old order got payload_hash %v, status %q", hash, orderStatus)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if !s.Applied || s.Modified {
+			t.Fatalf("unexpected status %+v", s)
+		}
+	}
+
+	if n, err := m.Down(ctx, len(m.migrations)); err != nil || n != len(m.migrations) {
+		t.Fatalf("down: rolled back %d, err %v", n, err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("up after down: %v", err)
+	}
+
+	// An applied script that changed since is refused
+	if _, err := pool.Exec(ctx, `UPDATE schema_migrations SET checksum = 'x' WHERE version = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func scratchDatabase(t *testing.T, dsn string) *pgxpool.Pool {
+	t.Helper()
+	ctx := context.Background()
+
+	admin, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(admin.Close)
+
+	name := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE DATABASE "+name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(ctx, "DROP DATABASE IF EXISTS "+name+" WITH (FORCE)")
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Path = "/" + name
+	pool, err := pgxpool.New(ctx, u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
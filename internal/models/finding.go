@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Severity of a finding
+type Severity string
+
+const (
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+// Weight is what the severity adds to the order score
+func (s Severity) Weight() int {
+	switch s {
+	case SeverityHigh:
+		return 10
+	case SeverityMedium:
+		return 5
+	case SeverityLow:
+		return 1
+	}
+	return 0
+}
+
+func (s Severity) Valid() bool {
+	return s.Weight() > 0
+}
+
+// Finding is one suspicious pattern the anomaly checker found in a stored
+// order. Details hold the values that triggered the rule
+type Finding struct {
+	ID        int64          `json:"id"`
+	OrderUID  string         `json:"order_uid"`
+	Rule      string         `json:"rule"`
+	Severity  Severity       `json:"severity"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// OrderFindings is the checker verdict on one order. Score sums the
+// severity weights, 0 means nothing was found. CheckedAt is nil while the
+// order was never checked, its score says nothing yet
+type OrderFindings struct {
+	OrderUID  string     `json:"order_uid"`
+	CheckedAt *time.Time `json:"checked_at"`
+	Score     int        `json:"score"`
+	Findings  []Finding  `json:"findings"`
+}
+
+func Score(findings []Finding) int {
+	var score int
+	for _, f := range findings {
+		score += f.Severity.Weight()
+	}
+	return score
+}
@@ -0,0 +1,13 @@
+package models
+
+import "testing"
+
+func TestScore(t *testing.T) {
+	fs := []Finding{{Severity: SeverityHigh}, {Severity: SeverityLow}, {Severity: SeverityLow}}
+	if got := Score(fs); got != 12 {
+		t.Fatalf("score %d, want 12", got)
+	}
+	if Severity("critical").Valid() {
+		t.Fatal("unknown severity is valid")
+	}
+}
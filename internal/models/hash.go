@@ -0,0 +1,19 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// ContentHash is a sha256 of the order canonical JSON. Two payloads that
+// decode to the same order have the same hash regardless of formatting.
+// Status and the validation report are not sent by the producer and are
+// left out
+func (o *Order) ContentHash() string {
+	c := *o
+	c.Status, c.Validation = "", nil
+	payload, _ := json.Marshal(&c)
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
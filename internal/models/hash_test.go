@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestContentHashIgnoresFormatting(t *testing.T) {
+	compact := `{"order_uid":"o-1","track_number":"TN-1","customer_id":"c-1","payment":{"transaction":"t-1","amount":10}}`
+	spaced := `{
+		"payment": {"amount": 10, "transaction": "t-1"},
+		"customer_id": "c-1",
+		"track_number": "TN-1",
+		"order_uid": "o-1"
+	}`
+
+	var a, b Order
+	if err := json.Unmarshal([]byte(compact), &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(spaced), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.ContentHash() != b.ContentHash() {
+		t.Fatalf("same order, different hashes: %s vs %s", a.ContentHash(), b.ContentHash())
+	}
+
+	b.Payment.Amount = 11
+	if a.ContentHash() == b.ContentHash() {
+		t.Fatal("different orders, same hash")
+	}
+}
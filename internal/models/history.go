@@ -0,0 +1,132 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Where a change to an order came from
+const (
+	SourceHTTP  = "http"
+	SourceKafka = "kafka"
+)
+
+// Kafka header carrying the X-Actor of POST /orders to the consumer
+const ActorHeader = "x-actor"
+
+// OrderEventType is a kind of entry in the order history
+type OrderEventType string
+
+const (
+	// First time the order was stored
+	OrderEventReceived OrderEventType = "received"
+	// Same payload delivered again, nothing changed
+	OrderEventRedelivered OrderEventType = "redelivered"
+	// Different payload under a stored order_uid, rejected
+	OrderEventConflict OrderEventType = "conflict"
+	// Status moved, see StatusChange
+	OrderEventStatusChanged OrderEventType = "status_changed"
+)
+
+// EventSource says who changed an order and through which path. Orders
+// sent to POST /orders come through Kafka too, they are marked http and
+// keep their submission id
+type EventSource struct {
+	Source       string `json:"source"`
+	Actor        string `json:"actor"`
+	SubmissionID string `json:"submission_id,omitempty"`
+
+	// Kafka position of the source message, if any
+	Topic     string `json:"topic,omitempty"`
+	Partition *int   `json:"partition,omitempty"`
+	Offset    *int64 `json:"offset,omitempty"`
+}
+
+// FromMessage fills the Kafka position of the source message
+func (s EventSource) FromMessage(topic string, partition int, offset int64) EventSource {
+	s.Topic = topic
+	s.Partition = &partition
+	s.Offset = &offset
+	return s
+}
+
+// OrderEvent is one append-only entry of the order history
+type OrderEvent struct {
+	ID       int64          `json:"id"`
+	OrderUID string         `json:"order_uid"`
+	Type     OrderEventType `json:"type"`
+	EventSource
+	// Content hash of the payload for received, redelivered and conflict
+	PayloadHash string        `json:"payload_hash,omitempty"`
+	Diff        []FieldChange `json:"diff,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// FieldChange is one changed field, Path is in JSON terms like
+// payment.amount or items[0].price
+type FieldChange struct {
+	Path string `json:"path"`
+	From any    `json:"from"`
+	To   any    `json:"to"`
+}
+
+// Diff lists the fields that differ between two versions of an order,
+// sorted by path. Status and the validation report are left out. Times are
+// compared in UTC at microseconds, as Postgres keeps them
+func Diff(from, to *Order) []FieldChange {
+	a, b := flatten(from), flatten(to)
+
+	paths := make([]string, 0, len(a))
+	for p := range a {
+		paths = append(paths, p)
+	}
+	for p := range b {
+		if _, ok := a[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	var changes []FieldChange
+	for _, p := range paths {
+		if a[p] != b[p] {
+			changes = append(changes, FieldChange{Path: p, From: a[p], To: b[p]})
+		}
+	}
+	return changes
+}
+
+// flatten maps JSON paths of the order to scalar values
+func flatten(o *Order) map[string]any {
+	c := *o
+	c.Status, c.Validation = "", nil
+	c.DateCreated = c.DateCreated.UTC().Truncate(time.Microsecond)
+
+	payload, _ := json.Marshal(&c)
+	var v any
+	json.Unmarshal(payload, &v)
+
+	out := make(map[string]any)
+	var walk func(path string, v any)
+	walk = func(path string, v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, child := range v {
+				if path != "" {
+					k = path + "." + k
+				}
+				walk(k, child)
+			}
+		case []any:
+			for i, child := range v {
+				walk(fmt.Sprintf("%s[%d]", path, i), child)
+			}
+		default:
+			out[path] = v
+		}
+	}
+	walk("", v)
+	return out
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)
+	from := &Order{
+		OrderUID:    "o-1",
+		TrackNumber: "TN-1",
+		Payment:     Payment{Amount: 100},
+		Items:       []Item{{ChrtID: 1, Price: 100}},
+		DateCreated: created,
+		Status:      StatusCreated,
+	}
+
+	// Same instant in another zone and status changes are not differences
+	same := *from
+	same.DateCreated = created.Truncate(time.Microsecond).In(time.FixedZone("MSK", 3*3600))
+	same.Status = StatusPaid
+	if changes := Diff(from, &same); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %+v", changes)
+	}
+
+	to := *from
+	to.Payment.Amount = 110
+	to.Items = []Item{{ChrtID: 1, Price: 90}}
+
+	want := []FieldChange{
+		{Path: "items[0].price", From: 100.0, To: 90.0},
+		{Path: "payment.amount", From: 100.0, To: 110.0},
+	}
+	if got := Diff(from, &to); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	// An added item shows up with nothing on the from side
+	to.Items = append(to.Items, Item{ChrtID: 2})
+	for _, c := range Diff(from, &to) {
+		if c.Path == "items[1].chrt_id" && (c.From != nil || c.To != 2.0) {
+			t.Fatalf("unexpected change for added item: %+v", c)
+		}
+	}
+}
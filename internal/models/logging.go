@@ -0,0 +1,29 @@
+package models
+
+import "log/slog"
+
+const redacted = "[REDACTED]"
+
+// LogValue keeps customer contacts out of logs, phone, address and email are masked
+func (d Delivery) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", d.Name),
+		slog.String("phone", redacted),
+		slog.String("zip", d.Zip),
+		slog.String("city", d.City),
+		slog.String("address", redacted),
+		slog.String("region", d.Region),
+		slog.String("email", redacted),
+	)
+}
+
+// LogValue logs an order summary instead of the full graph
+func (o Order) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("order_uid", o.OrderUID),
+		slog.String("track_number", o.TrackNumber),
+		slog.String("customer_id", o.CustomerID),
+		slog.Any("delivery", o.Delivery),
+		slog.Int("items", len(o.Items)),
+	)
+}
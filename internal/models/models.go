@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/apperr"
+)
 
 type Delivery struct {
 	Name    string `json:"name"`
@@ -54,6 +58,19 @@ type Order struct {
 	SmID              int       `json:"sm_id"`
 	DateCreated       time.Time `json:"date_created"`
 	OofShard          string    `json:"oof_shard"`
+
+	// Lifecycle status, set by the service. Not part of the payload hash
+	Status OrderStatus `json:"status,omitempty"`
+	// How the order passed validation, set by the consumer. Not part of
+	// the payload hash
+	Validation *ValidationReport `json:"validation,omitempty"`
+}
+
+// ValidationReport names the profile an order was checked with and the
+// violations that profile let through as warnings
+type ValidationReport struct {
+	Profile  string              `json:"profile"`
+	Warnings []apperr.FieldError `json:"warnings,omitempty"`
 }
 
 func (i *Item) CalculateTotalPrice() int {
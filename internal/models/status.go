@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/apperr"
+)
+
+// OrderStatus is where an order is in its lifecycle. Every stored order
+// starts as created
+type OrderStatus string
+
+const (
+	StatusCreated    OrderStatus = "created"
+	StatusPaid       OrderStatus = "paid"
+	StatusAssembling OrderStatus = "assembling"
+	StatusShipped    OrderStatus = "shipped"
+	StatusDelivered  OrderStatus = "delivered"
+	StatusCancelled  OrderStatus = "cancelled"
+	StatusReturned   OrderStatus = "returned"
+)
+
+// Allowed transitions. Cancelled and returned are final
+var statusTransitions = map[OrderStatus][]OrderStatus{
+	StatusCreated:    {StatusPaid, StatusCancelled},
+	StatusPaid:       {StatusAssembling, StatusCancelled},
+	StatusAssembling: {StatusShipped, StatusCancelled},
+	StatusShipped:    {StatusDelivered, StatusReturned},
+	StatusDelivered:  {StatusReturned},
+	StatusCancelled:  {},
+	StatusReturned:   {},
+}
+
+var (
+	ErrUnknownStatus     = apperr.Errorf(apperr.ErrValidation, "unknown order status")
+	ErrIllegalTransition = apperr.Errorf(apperr.ErrConflict, "illegal status transition")
+)
+
+// IllegalTransitionError names both ends and what would have been allowed
+type IllegalTransitionError struct {
+	From, To OrderStatus
+}
+
+func (e *IllegalTransitionError) Error() string {
+	next := statusTransitions[e.From]
+	if len(next) == 0 {
+		return fmt.Sprintf("cannot move order from %s to %s: %s is final", e.From, e.To, e.From)
+	}
+	allowed := make([]string, len(next))
+	for i, s := range next {
+		allowed[i] = string(s)
+	}
+	return fmt.Sprintf("cannot move order from %s to %s, allowed: %s", e.From, e.To, strings.Join(allowed, ", "))
+}
+
+func (e *IllegalTransitionError) Unwrap() error {
+	return ErrIllegalTransition
+}
+
+func (s OrderStatus) Valid() bool {
+	_, ok := statusTransitions[s]
+	return ok
+}
+
+// Next lists the statuses s can move to
+func (s OrderStatus) Next() []OrderStatus {
+	return statusTransitions[s]
+}
+
+// CheckTransition returns nil if from -> to is allowed, ErrUnknownStatus
+// for an unknown target and *IllegalTransitionError otherwise
+func CheckTransition(from, to OrderStatus) error {
+	if !to.Valid() {
+		return fmt.Errorf("%w %q", ErrUnknownStatus, to)
+	}
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return &IllegalTransitionError{From: from, To: to}
+}
+
+// StatusChange is one applied transition
+type StatusChange struct {
+	ID        int64       `json:"id"`
+	OrderUID  string      `json:"order_uid"`
+	From      OrderStatus `json:"from"`
+	To        OrderStatus `json:"to"`
+	Actor     string      `json:"actor"`
+	Reason    string      `json:"reason,omitempty"`
+	ChangedAt time.Time   `json:"changed_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckTransition(t *testing.T) {
+	cases := []struct {
+		from, to OrderStatus
+		want     error
+	}{
+		{StatusCreated, StatusPaid, nil},
+		{StatusPaid, StatusAssembling, nil},
+		{StatusShipped, StatusReturned, nil},
+		{StatusCreated, StatusShipped, ErrIllegalTransition},
+		{StatusDelivered, StatusPaid, ErrIllegalTransition},
+		{StatusCancelled, StatusPaid, ErrIllegalTransition},
+		{StatusCreated, "lost", ErrUnknownStatus},
+	}
+	for _, tc := range cases {
+		err := CheckTransition(tc.from, tc.to)
+		if !errors.Is(err, tc.want) || (tc.want == nil && err != nil) {
+			t.Errorf("%s -> %s: got %v, want %v", tc.from, tc.to, err, tc.want)
+		}
+	}
+
+	err := CheckTransition(StatusShipped, StatusPaid)
+	if err.Error() != "cannot move order from shipped to paid, allowed: delivered, returned" {
+		t.Errorf("unexpected message %q", err)
+	}
+}
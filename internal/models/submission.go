@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Submission statuses
+const (
+	SubmissionQueued       = "queued"
+	SubmissionPersisted    = "persisted"
+	SubmissionRejected     = "rejected"
+	SubmissionDeadLettered = "dead_lettered"
+)
+
+// Kafka header carrying the submission id from POST /orders to the consumer
+const SubmissionIDHeader = "x-submission-id"
+
+// Submission tracks an order accepted by POST /orders until the consumer
+// persists or rejects it
+type Submission struct {
+	ID        string    `json:"submission_id"`
+	OrderUID  string    `json:"order_uid"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,144 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/tmozzze/order_checker/internal/logging"
+	"github.com/tmozzze/order_checker/internal/repository"
+	"github.com/tmozzze/order_checker/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Relay publishes pending outbox rows to Kafka and marks them sent
+type Relay struct {
+	repo         *repository.OutboxRepository
+	writer       *kafka.Writer
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+	retryDelay   time.Duration
+	log          *slog.Logger
+}
+
+func NewRelay(repo *repository.OutboxRepository, writer *kafka.Writer,
+	pollInterval time.Duration, batchSize, maxAttempts int, logger *slog.Logger) *Relay {
+	return &Relay{
+		repo:         repo,
+		writer:       writer,
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+		maxAttempts:  maxAttempts,
+		retryDelay:   time.Second,
+		log:          logger.With("component", "outbox_relay"),
+	}
+}
+
+// Run polls the outbox until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	r.log.InfoContext(ctx, "outbox relay started")
+
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain everything that is ready before waiting for the next tick
+		for {
+			sent, err := r.repo.ProcessPending(ctx, r.batchSize, r.publish)
+			if err != nil {
+				if ctx.Err() == nil {
+					r.log.ErrorContext(ctx, "outbox relay error", "error", err)
+				}
+				break
+			}
+			if sent < r.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			r.log.InfoContext(ctx, "outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, msgs []repository.OutboxMessage) []repository.PublishResult {
+	batch := make([]kafka.Message, len(msgs))
+	spans := make([]trace.Span, len(msgs))
+	for i, m := range msgs {
+		// Producer span continues the trace of the HTTP request stored in
+		// the outbox row and is what the consumer span links to
+		msgCtx := tracing.Extract(ctx, propagation.MapCarrier(m.Headers))
+		msgCtx, spans[i] = tracing.Tracer().Start(msgCtx, "kafka.publish "+m.Topic,
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.destination.name", m.Topic),
+				attribute.String("order.uid", m.OrderUID),
+			),
+		)
+
+		headers := make([]kafka.Header, 0, len(m.Headers))
+		for k, v := range m.Headers {
+			headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+		tracing.Inject(msgCtx, tracing.KafkaHeaders{Headers: &headers})
+
+		// Key by order_uid: one order always lands in one partition
+		batch[i] = kafka.Message{
+			Topic:   m.Topic,
+			Key:     []byte(m.OrderUID),
+			Value:   m.Payload,
+			Headers: headers,
+		}
+	}
+	defer func() {
+		for _, span := range spans {
+			span.End()
+		}
+	}()
+
+	err := r.writer.WriteMessages(ctx, batch...)
+
+	results := make([]repository.PublishResult, len(msgs))
+	if err == nil {
+		return results
+	}
+
+	var writeErrs kafka.WriteErrors
+	perMessage := errors.As(err, &writeErrs) && len(writeErrs) == len(msgs)
+
+	for i, m := range msgs {
+		msgErr := err
+		if perMessage {
+			msgErr = writeErrs[i]
+		}
+		if msgErr == nil {
+			continue
+		}
+		tracing.RecordError(spans[i], msgErr)
+
+		attempts := m.Attempts + 1
+		results[i] = repository.PublishResult{
+			Err:     msgErr,
+			RetryAt: time.Now().Add(r.retryDelay * time.Duration(1<<min(attempts, 10))),
+			GiveUp:  attempts >= r.maxAttempts,
+		}
+		r.log.WarnContext(ctx, "failed to publish outbox message",
+			"outbox_id", m.ID,
+			slog.String(logging.KeyOrderUID, m.OrderUID),
+			"attempt", attempts,
+			"give_up", results[i].GiveUp,
+			"error", msgErr,
+		)
+	}
+	return results
+}
@@ -0,0 +1,122 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/segmentio/kafka-go"
+	"github.com/tmozzze/order_checker/internal/models"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+func TestRelayAttemptsAndSent(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	repo := repository.NewOutboxRepository(pool)
+	submissions := repository.NewSubmissionRepository(pool)
+
+	// Two submissions of one order, queued the way POST /orders does it
+	uid := fmt.Sprintf("outbox-%d", time.Now().UnixNano())
+	first := &repository.OutboxMessage{OrderUID: uid, Topic: "orders", Payload: []byte(`{"n":1}`)}
+	second := &repository.OutboxMessage{OrderUID: uid, Topic: "orders", Payload: []byte(`{"n":2}`)}
+	for i, m := range []*repository.OutboxMessage{first, second} {
+		sub := &models.Submission{ID: fmt.Sprintf("%s-%d", uid, i), OrderUID: uid, Status: models.SubmissionQueued}
+		if err := submissions.Create(ctx, sub, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing listens there, every write fails at once
+	writer := &kafka.Writer{Addr: kafka.TCP("127.0.0.1:1"), MaxAttempts: 1, Balancer: &kafka.Hash{}}
+	defer writer.Close()
+	relay := NewRelay(repo, writer, time.Hour, 100, 2, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	var claimed []int64
+	failing := func(ctx context.Context, msgs []repository.OutboxMessage) []repository.PublishResult {
+		for _, m := range msgs {
+			claimed = append(claimed, m.ID)
+		}
+		return relay.publish(ctx, msgs)
+	}
+	row := func(id int64) (status string, attempts int, lastError *string) {
+		t.Helper()
+		err := pool.QueryRow(ctx, `SELECT status, attempts, last_error FROM outbox WHERE id = $1`, id).
+			Scan(&status, &attempts, &lastError)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return status, attempts, lastError
+	}
+	due := func(id int64) {
+		t.Helper()
+		if _, err := pool.Exec(ctx, `UPDATE outbox SET next_attempt_at = now() WHERE id = $1`, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A failed publish counts the attempt and backs off. The second message
+	// of the order waits for the first
+	if _, err := repo.ProcessPending(ctx, 100, failing); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(claimed, first.ID) || slices.Contains(claimed, second.ID) {
+		t.Fatalf("claimed %v, want %d and not %d", claimed, first.ID, second.ID)
+	}
+	if status, attempts, lastError := row(first.ID); status != repository.OutboxPending || attempts != 1 || lastError == nil {
+		t.Fatalf("after a failure: status %s, attempts %d, last_error %v", status, attempts, lastError)
+	}
+
+	// Out of attempts: failed, listed as a problem
+	due(first.ID)
+	if _, err := repo.ProcessPending(ctx, 100, failing); err != nil {
+		t.Fatal(err)
+	}
+	if status, attempts, _ := row(first.ID); status != repository.OutboxFailed || attempts != 2 {
+		t.Fatalf("after max attempts: status %s, attempts %d", status, attempts)
+	}
+	problems, err := repo.ListProblems(ctx, repository.OutboxFailed, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(problems, func(m repository.OutboxMessage) bool { return m.ID == first.ID }) {
+		t.Fatalf("failed message %d not listed", first.ID)
+	}
+
+	// Retried by hand, then published
+	if ok, err := repo.Retry(ctx, first.ID); err != nil || !ok {
+		t.Fatalf("Retry: %v, %v", ok, err)
+	}
+	published := func(ctx context.Context, msgs []repository.OutboxMessage) []repository.PublishResult {
+		return make([]repository.PublishResult, len(msgs))
+	}
+	if _, err := repo.ProcessPending(ctx, 100, published); err != nil {
+		t.Fatal(err)
+	}
+	if status, attempts, lastError := row(first.ID); status != repository.OutboxSent || attempts != 1 || lastError != nil {
+		t.Fatalf("after publishing: status %s, attempts %d, last_error %v", status, attempts, lastError)
+	}
+
+	// Now the second one is free to go
+	if _, err := repo.ProcessPending(ctx, 100, published); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, _ := row(second.ID); status != repository.OutboxSent {
+		t.Fatalf("second message status %s", status)
+	}
+}
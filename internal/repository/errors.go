@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/tmozzze/order_checker/internal/apperr"
+)
+
+// dbErr maps driver errors to domain errors: no rows to apperr.ErrNotFound
+// for what, lost connections to apperr.ErrUnavailable. Others pass as is
+func dbErr(what string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pgx.ErrNoRows):
+		return apperr.NotFound(what, err)
+	case IsUnavailable(err):
+		return apperr.Unavailable(err)
+	}
+	return err
+}
+
+// IsUnavailable reports whether err means Postgres could not be reached
+// or refused work for now: lost connections, shutdowns, exhausted
+// resources and pool acquire timeouts
+func IsUnavailable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, apperr.ErrUnavailable) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "08") || // connection_exception
+			strings.HasPrefix(pgErr.Code, "53") || // insufficient_resources
+			strings.HasPrefix(pgErr.Code, "57P") // admin/crash shutdown, cannot_connect_now
+	}
+
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) {
+		return true
+	}
+
+	// Pool acquire timeout surfaces as deadline exceeded
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) {
+		return true
+	}
+
+	if pgconn.SafeToRetry(err) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+// Cap of the order and customer lists the anomaly rules look at
+const maxRelated = 100
+
+// FindingFilter describes GET /findings query. Empty fields are ignored
+type FindingFilter struct {
+	Severity models.Severity
+	Rule     string
+	Limit    int
+	Cursor   string // id of the last finding of the previous page
+}
+
+type FindingPage struct {
+	Findings   []models.Finding `json:"findings"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+type FindingRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewFindingRepository(pool *pgxpool.Pool) *FindingRepository {
+	return &FindingRepository{pool: pool}
+}
+
+const findingColumns = `id, order_uid, rule, severity, message, details, created_at`
+
+func scanFinding(row pgx.Row, f *models.Finding) error {
+	return row.Scan(&f.ID, &f.OrderUID, &f.Rule, &f.Severity, &f.Message, &f.Details, &f.CreatedAt)
+}
+
+// ReplaceFindings stores the result of checking an order, dropping what an
+// earlier check found, and marks the order checked. IDs and times are
+// filled in. Returns the time of this check and the findings the earlier
+// check did not have
+func (r *FindingRepository) ReplaceFindings(ctx context.Context, orderUID string, findings []models.Finding) (time.Time, []models.Finding, error) {
+	ctx, done := observe(ctx, "Finding.ReplaceFindings")
+	defer done()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return time.Time{}, nil, dbErr("finding", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Locks the order's check so concurrent checks replace one after another
+	var checkedAt time.Time
+	err = tx.QueryRow(ctx, `
+		INSERT INTO order_checks (order_uid) VALUES ($1)
+		ON CONFLICT (order_uid) DO UPDATE SET checked_at = now()
+		RETURNING checked_at
+	`, orderUID).Scan(&checkedAt)
+	if err != nil {
+		return time.Time{}, nil, dbErr("finding", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		DELETE FROM order_findings WHERE order_uid = $1
+		RETURNING rule, severity, message
+	`, orderUID)
+	if err != nil {
+		return time.Time{}, nil, dbErr("finding", err)
+	}
+	earlier := make(map[findingKey]int)
+	for rows.Next() {
+		var k findingKey
+		if err := rows.Scan(&k.rule, &k.severity, &k.message); err != nil {
+			rows.Close()
+			return time.Time{}, nil, dbErr("finding", err)
+		}
+		earlier[k]++
+	}
+	if err := rows.Err(); err != nil {
+		return time.Time{}, nil, dbErr("finding", err)
+	}
+
+	var added []models.Finding
+	for i := range findings {
+		f := &findings[i]
+		f.OrderUID = orderUID
+		err := tx.QueryRow(ctx, `
+			INSERT INTO order_findings (order_uid, rule, severity, message, details)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at
+		`, f.OrderUID, f.Rule, f.Severity, f.Message, f.Details).Scan(&f.ID, &f.CreatedAt)
+		if err != nil {
+			return time.Time{}, nil, dbErr("finding", err)
+		}
+
+		k := findingKey{f.Rule, f.Severity, f.Message}
+		if earlier[k] > 0 {
+			earlier[k]--
+		} else {
+			added = append(added, *f)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return time.Time{}, nil, dbErr("finding", err)
+	}
+	return checkedAt, added, nil
+}
+
+// CheckedAt tells when the order was last checked, apperr.ErrNotFound if
+// it never was
+func (r *FindingRepository) CheckedAt(ctx context.Context, orderUID string) (time.Time, error) {
+	ctx, done := observe(ctx, "Finding.CheckedAt")
+	defer done()
+
+	var t time.Time
+	err := r.pool.QueryRow(ctx, `
+		SELECT checked_at FROM order_checks WHERE order_uid = $1
+	`, orderUID).Scan(&t)
+	return t, dbErr("order check", err)
+}
+
+// findingKey tells whether a re-check found the same thing again
+type findingKey struct {
+	rule     string
+	severity models.Severity
+	message  string
+}
+
+// Listing the findings of one order, most severe first
+func (r *FindingRepository) ListOrderFindings(ctx context.Context, orderUID string) ([]models.Finding, error) {
+	ctx, done := observe(ctx, "Finding.ListOrderFindings")
+	defer done()
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+findingColumns+`
+		FROM order_findings
+		WHERE order_uid = $1
+		ORDER BY CASE severity WHEN 'high' THEN 0 WHEN 'medium' THEN 1 ELSE 2 END, id
+	`, orderUID)
+	if err != nil {
+		return nil, dbErr("finding", err)
+	}
+	defer rows.Close()
+
+	findings := []models.Finding{}
+	for rows.Next() {
+		var f models.Finding
+		if err := scanFinding(rows, &f); err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+// Listing findings of all orders, newest first, with keyset pagination on id
+func (r *FindingRepository) ListFindings(ctx context.Context, f FindingFilter) (*FindingPage, error) {
+	ctx, done := observe(ctx, "Finding.ListFindings")
+	defer done()
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultListLimit
+	}
+	if f.Limit > MaxListLimit {
+		f.Limit = MaxListLimit
+	}
+
+	var b queryBuilder
+	if f.Severity != "" {
+		b.where("severity = " + b.arg(f.Severity))
+	}
+	if f.Rule != "" {
+		b.where("rule = " + b.arg(f.Rule))
+	}
+	if f.Cursor != "" {
+		id, err := strconv.ParseInt(f.Cursor, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, ErrInvalidCursor
+		}
+		b.where("id < " + b.arg(id))
+	}
+
+	// One extra row tells whether there is a next page
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+findingColumns+`
+		FROM order_findings
+		`+b.whereClause()+`
+		ORDER BY id DESC
+		LIMIT `+b.arg(f.Limit+1), b.args...)
+	if err != nil {
+		return nil, dbErr("finding", err)
+	}
+	defer rows.Close()
+
+	page := &FindingPage{Findings: []models.Finding{}}
+	for rows.Next() {
+		var fd models.Finding
+		if err := scanFinding(rows, &fd); err != nil {
+			return nil, err
+		}
+		page.Findings = append(page.Findings, fd)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbErr("finding", err)
+	}
+
+	if len(page.Findings) > f.Limit {
+		page.Findings = page.Findings[:f.Limit]
+		page.NextCursor = strconv.FormatInt(page.Findings[f.Limit-1].ID, 10)
+	}
+	return page, nil
+}
+
+// OrdersWithTransaction lists other orders paid with the same transaction
+func (r *FindingRepository) OrdersWithTransaction(ctx context.Context, transaction, exceptUID string) ([]string, error) {
+	ctx, done := observe(ctx, "Finding.OrdersWithTransaction")
+	defer done()
+
+	return r.strings(ctx, `
+		SELECT DISTINCT order_uid FROM payments
+		WHERE transaction = $1 AND order_uid <> $2
+		ORDER BY order_uid
+		LIMIT $3
+	`, transaction, exceptUID, maxRelated)
+}
+
+// OrdersWithContact lists other orders delivered to phone or email. An
+// empty phone or email matches nothing
+func (r *FindingRepository) OrdersWithContact(ctx context.Context, phone, email, exceptUID string) ([]string, error) {
+	ctx, done := observe(ctx, "Finding.OrdersWithContact")
+	defer done()
+
+	return r.strings(ctx, `
+		SELECT DISTINCT order_uid FROM deliveries
+		WHERE ((phone = $1 AND $1 <> '') OR (email = $2 AND $2 <> '')) AND order_uid <> $3
+		ORDER BY order_uid
+		LIMIT $4
+	`, phone, email, exceptUID, maxRelated)
+}
+
+// UncheckedOrders lists up to limit orders after the given order_uid that
+// the checker has never seen
+func (r *FindingRepository) UncheckedOrders(ctx context.Context, after string, limit int) ([]string, error) {
+	ctx, done := observe(ctx, "Finding.UncheckedOrders")
+	defer done()
+
+	return r.strings(ctx, `
+		SELECT o.order_uid FROM orders o
+		WHERE o.order_uid > $1
+			AND NOT EXISTS (SELECT 1 FROM order_checks c WHERE c.order_uid = o.order_uid)
+		ORDER BY o.order_uid
+		LIMIT $2
+	`, after, limit)
+}
+
+// CustomersWithPhone lists the customers whose orders were delivered to phone
+func (r *FindingRepository) CustomersWithPhone(ctx context.Context, phone string) ([]string, error) {
+	ctx, done := observe(ctx, "Finding.CustomersWithPhone")
+	defer done()
+
+	return r.strings(ctx, `
+		SELECT DISTINCT o.customer_id FROM deliveries d
+		JOIN orders o ON o.order_uid = d.order_uid
+		WHERE d.phone = $1
+		ORDER BY o.customer_id
+		LIMIT $2
+	`, phone, maxRelated)
+}
+
+// CustomersWithEmail lists the customers whose orders were delivered to email
+func (r *FindingRepository) CustomersWithEmail(ctx context.Context, email string) ([]string, error) {
+	ctx, done := observe(ctx, "Finding.CustomersWithEmail")
+	defer done()
+
+	return r.strings(ctx, `
+		SELECT DISTINCT o.customer_id FROM deliveries d
+		JOIN orders o ON o.order_uid = d.order_uid
+		WHERE d.email = $1
+		ORDER BY o.customer_id
+		LIMIT $2
+	`, email, maxRelated)
+}
+
+func (r *FindingRepository) strings(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, dbErr("finding", err)
+	}
+	list, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	return list, dbErr("finding", err)
+}
@@ -0,0 +1,98 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/models"
+	"github.com/tmozzze/order_checker/internal/repository"
+	"github.com/tmozzze/order_checker/internal/repository/storetest"
+)
+
+func TestFindingRepository(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	orders := repository.NewOrderRepository(pool)
+	findings := repository.NewFindingRepository(pool)
+
+	// Two customers paying with one transaction from one phone
+	first, second := storetest.Order("finding"), storetest.Order("finding")
+	second.Payment.Transaction = first.Payment.Transaction
+	first.Delivery.Phone = "+7" + first.OrderUID[len(first.OrderUID)-10:]
+	second.Delivery.Phone = first.Delivery.Phone
+	for _, o := range []*models.Order{first, second} {
+		if err := orders.SaveOrder(ctx, o, models.EventSource{Source: models.SourceKafka}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	others, err := findings.OrdersWithTransaction(ctx, first.Payment.Transaction, first.OrderUID)
+	if err != nil || len(others) != 1 || others[0] != second.OrderUID {
+		t.Fatalf("OrdersWithTransaction: %v, %v", others, err)
+	}
+	customers, err := findings.CustomersWithPhone(ctx, first.Delivery.Phone)
+	if err != nil || len(customers) != 2 {
+		t.Fatalf("CustomersWithPhone: %v, %v", customers, err)
+	}
+	related, err := findings.OrdersWithContact(ctx, first.Delivery.Phone, "", first.OrderUID)
+	if err != nil || len(related) != 1 || related[0] != second.OrderUID {
+		t.Fatalf("OrdersWithContact: %v, %v", related, err)
+	}
+
+	// Both are unchecked until their findings are stored
+	unchecked, err := findings.UncheckedOrders(ctx, first.OrderUID, 1)
+	if err != nil || len(unchecked) != 1 || unchecked[0] <= first.OrderUID {
+		t.Fatalf("UncheckedOrders: %v, %v", unchecked, err)
+	}
+
+	fs := []models.Finding{
+		{Rule: "huge_sale", Severity: models.SeverityMedium, Message: "sale", Details: map[string]any{"sale": 90.0}},
+		{Rule: "transaction_reused", Severity: models.SeverityHigh, Message: "reused"},
+	}
+	if _, err := findings.CheckedAt(ctx, first.OrderUID); !errors.Is(err, apperr.ErrNotFound) {
+		t.Fatalf("unchecked order: expected apperr.ErrNotFound, got %v", err)
+	}
+	checkedAt, added, err := findings.ReplaceFindings(ctx, first.OrderUID, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := findings.CheckedAt(ctx, first.OrderUID); err != nil || !got.Equal(checkedAt) {
+		t.Fatalf("CheckedAt: %v, %v, want %v", got, err, checkedAt)
+	}
+	if fs[0].ID == 0 || fs[0].OrderUID != first.OrderUID {
+		t.Fatalf("finding not filled: %+v", fs[0])
+	}
+	if len(added) != 2 {
+		t.Fatalf("first check added %d findings, want 2", len(added))
+	}
+	if _, _, err := findings.ReplaceFindings(ctx, second.OrderUID, nil); err != nil {
+		t.Fatal(err)
+	}
+	unchecked, err = findings.UncheckedOrders(ctx, "", repository.MaxListLimit)
+	if err != nil || slices.Contains(unchecked, first.OrderUID) || slices.Contains(unchecked, second.OrderUID) {
+		t.Fatalf("checked orders listed as unchecked: %v, %v", unchecked, err)
+	}
+
+	// Most severe first
+	got, err := findings.ListOrderFindings(ctx, first.OrderUID)
+	if err != nil || len(got) != 2 || got[0].Rule != "transaction_reused" || got[1].Details["sale"] != 90.0 {
+		t.Fatalf("ListOrderFindings: %+v, %v", got, err)
+	}
+
+	// A re-check replaces, what it found before is not new
+	_, added, err = findings.ReplaceFindings(ctx, first.OrderUID, fs[:1])
+	if err != nil || len(added) != 0 {
+		t.Fatalf("re-check added %+v, %v", added, err)
+	}
+	page, err := findings.ListFindings(ctx, repository.FindingFilter{Severity: models.SeverityMedium, Rule: "huge_sale", Limit: 1})
+	if err != nil || len(page.Findings) != 1 || page.Findings[0].OrderUID != first.OrderUID {
+		t.Fatalf("ListFindings: %+v, %v", page, err)
+	}
+
+	if _, err := findings.ListFindings(ctx, repository.FindingFilter{Cursor: "x"}); !errors.Is(err, repository.ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
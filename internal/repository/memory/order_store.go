@@ -0,0 +1,268 @@
+// Package memory keeps orders in process. It has the semantics of the
+// Postgres repository and is meant for tests and local runs without a
+// database
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/models"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+type storedOrder struct {
+	order *models.Order
+	hash  string
+}
+
+// OrderStore is an in-memory repository.OrderStore. Orders are copied in
+// and out, callers never share memory with the store
+type OrderStore struct {
+	mu      sync.RWMutex
+	orders  map[string]*storedOrder
+	changes map[string][]models.StatusChange
+	events  map[string][]models.OrderEvent
+	lastID  int64
+}
+
+var _ repository.OrderStore = (*OrderStore)(nil)
+
+func NewOrderStore() *OrderStore {
+	return &OrderStore{
+		orders:  make(map[string]*storedOrder),
+		changes: make(map[string][]models.StatusChange),
+		events:  make(map[string][]models.OrderEvent),
+	}
+}
+
+func (s *OrderStore) GetOrderById(ctx context.Context, orderID string) (*models.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	so, ok := s.orders[orderID]
+	if !ok {
+		return nil, apperr.NotFound("order", pgx.ErrNoRows)
+	}
+	return clone(so.order), nil
+}
+
+// SaveOrder stores a new order, accepts an identical one again and
+// rejects different content under a known order_uid with
+// *repository.OrderConflictError. Every call is recorded in the history
+func (s *OrderStore) SaveOrder(ctx context.Context, o *models.Order, src models.EventSource) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := o.ContentHash()
+	e := models.OrderEvent{OrderUID: o.OrderUID, EventSource: src, PayloadHash: hash}
+
+	so, ok := s.orders[o.OrderUID]
+	switch {
+	case !ok:
+		o.Status = models.StatusCreated
+		s.orders[o.OrderUID] = &storedOrder{order: clone(o), hash: hash}
+		e.Type = models.OrderEventReceived
+		s.appendEvent(e)
+		return nil
+	case so.hash == hash:
+		o.Status = so.order.Status
+		e.Type = models.OrderEventRedelivered
+		s.appendEvent(e)
+		return nil
+	}
+
+	e.Type = models.OrderEventConflict
+	e.Diff = models.Diff(so.order, o)
+	s.appendEvent(e)
+	return &repository.OrderConflictError{OrderUID: o.OrderUID, StoredHash: so.hash, IncomingHash: hash}
+}
+
+// ListOrders filters and pages like the Postgres query: keyset on
+// (date_created, order_uid), newest first unless sorted ascending
+func (s *OrderStore) ListOrders(ctx context.Context, f repository.OrderFilter) (*repository.OrderPage, error) {
+	if f.Limit <= 0 {
+		f.Limit = repository.DefaultListLimit
+	}
+	if f.Limit > repository.MaxListLimit {
+		f.Limit = repository.MaxListLimit
+	}
+
+	var asc bool
+	switch f.Sort {
+	case "", repository.SortDateDesc:
+	case repository.SortDateAsc:
+		asc = true
+	default:
+		return nil, repository.ErrInvalidSort
+	}
+
+	var after *repository.Cursor
+	if f.Cursor != "" {
+		c, err := repository.DecodeCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &c
+	}
+
+	s.mu.RLock()
+	var orders []models.Order
+	for _, so := range s.orders {
+		o := so.order
+		if !matches(o, f) {
+			continue
+		}
+		if after != nil {
+			cmp := compareKey(o, after.DateCreated, after.OrderUID)
+			if (asc && cmp <= 0) || (!asc && cmp >= 0) {
+				continue
+			}
+		}
+		orders = append(orders, *clone(o))
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(orders, func(i, j int) bool {
+		cmp := compareKey(&orders[i], orders[j].DateCreated, orders[j].OrderUID)
+		if asc {
+			return cmp < 0
+		}
+		return cmp > 0
+	})
+
+	page := &repository.OrderPage{Orders: orders}
+	if len(orders) > f.Limit {
+		page.Orders = orders[:f.Limit]
+		page.NextCursor = repository.EncodeCursor(&page.Orders[f.Limit-1])
+	}
+	if page.Orders == nil {
+		page.Orders = []models.Order{}
+	}
+	return page, nil
+}
+
+// Getting the most recent orders by date_created, newest first
+func (s *OrderStore) GetRecentOrders(ctx context.Context, limit, offset int) ([]models.Order, error) {
+	page, err := s.ListOrders(ctx, repository.OrderFilter{Limit: repository.MaxListLimit})
+	if err != nil {
+		return nil, err
+	}
+
+	// ListOrders caps the page, read all of it here
+	orders := page.Orders
+	for page.NextCursor != "" {
+		page, err = s.ListOrders(ctx, repository.OrderFilter{Limit: repository.MaxListLimit, Cursor: page.NextCursor})
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, page.Orders...)
+	}
+
+	if offset >= len(orders) {
+		return nil, nil
+	}
+	return orders[offset:min(offset+limit, len(orders))], nil
+}
+
+func (s *OrderStore) GetOrderStatus(ctx context.Context, orderUID string) (models.OrderStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	so, ok := s.orders[orderUID]
+	if !ok {
+		return "", apperr.NotFound("order", pgx.ErrNoRows)
+	}
+	return so.order.Status, nil
+}
+
+// UpdateStatus moves the order from c.From to c.To. Returns
+// repository.ErrStatusChanged if the order is not in c.From
+func (s *OrderStore) UpdateStatus(ctx context.Context, c *models.StatusChange, src models.EventSource) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	so, ok := s.orders[c.OrderUID]
+	if !ok || so.order.Status != c.From {
+		return repository.ErrStatusChanged
+	}
+	so.order.Status = c.To
+
+	s.lastID++
+	c.ID, c.ChangedAt = s.lastID, time.Now()
+	s.changes[c.OrderUID] = append(s.changes[c.OrderUID], *c)
+
+	s.appendEvent(models.OrderEvent{
+		OrderUID:    c.OrderUID,
+		Type:        models.OrderEventStatusChanged,
+		EventSource: src,
+		Diff:        []models.FieldChange{{Path: "status", From: c.From, To: c.To}},
+	})
+	return nil
+}
+
+func (s *OrderStore) ListStatusChanges(ctx context.Context, orderUID string) ([]models.StatusChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]models.StatusChange{}, s.changes[orderUID]...), nil
+}
+
+func (s *OrderStore) ListOrderEvents(ctx context.Context, orderUID string) ([]models.OrderEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]models.OrderEvent{}, s.events[orderUID]...), nil
+}
+
+// appendEvent needs s.mu held for writing
+func (s *OrderStore) appendEvent(e models.OrderEvent) {
+	s.lastID++
+	e.ID, e.CreatedAt = s.lastID, time.Now()
+	s.events[e.OrderUID] = append(s.events[e.OrderUID], e)
+}
+
+func matches(o *models.Order, f repository.OrderFilter) bool {
+	switch {
+	case f.CustomerID != "" && o.CustomerID != f.CustomerID,
+		f.TrackNumber != "" && o.TrackNumber != f.TrackNumber,
+		!f.CreatedFrom.IsZero() && o.DateCreated.Before(f.CreatedFrom),
+		!f.CreatedTo.IsZero() && !o.DateCreated.Before(f.CreatedTo),
+		f.Provider != "" && o.Payment.Provider != f.Provider,
+		f.Currency != "" && o.Payment.Currency != f.Currency,
+		f.City != "" && o.Delivery.City != f.City:
+		return false
+	}
+	if f.Brand != "" {
+		return slices.ContainsFunc(o.Items, func(i models.Item) bool { return i.Brand == f.Brand })
+	}
+	return true
+}
+
+// compareKey orders by (date_created, order_uid) like the keyset index
+func compareKey(o *models.Order, date time.Time, uid string) int {
+	if c := o.DateCreated.Compare(date); c != 0 {
+		return c
+	}
+	switch {
+	case o.OrderUID < uid:
+		return -1
+	case o.OrderUID > uid:
+		return 1
+	}
+	return 0
+}
+
+func clone(o *models.Order) *models.Order {
+	c := *o
+	c.Items = slices.Clone(o.Items)
+	if o.Validation != nil {
+		v := *o.Validation
+		v.Warnings = slices.Clone(v.Warnings)
+		c.Validation = &v
+	}
+	return &c
+}
@@ -0,0 +1,20 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/tmozzze/order_checker/internal/repository"
+	"github.com/tmozzze/order_checker/internal/repository/storetest"
+)
+
+func TestOrderStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) repository.OrderStore {
+		return NewOrderStore()
+	})
+}
+
+func TestSubmissionStoreConformance(t *testing.T) {
+	storetest.RunSubmissions(t, func(t *testing.T) repository.SubmissionStore {
+		return NewSubmissionStore()
+	})
+}
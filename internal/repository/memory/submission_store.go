@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/models"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+// SubmissionStore is an in-memory repository.SubmissionStore. Outbox
+// messages are kept in order and never published
+type SubmissionStore struct {
+	mu          sync.RWMutex
+	submissions map[string]models.Submission
+	outbox      []repository.OutboxMessage
+}
+
+var _ repository.SubmissionStore = (*SubmissionStore)(nil)
+
+func NewSubmissionStore() *SubmissionStore {
+	return &SubmissionStore{submissions: make(map[string]models.Submission)}
+}
+
+func (s *SubmissionStore) Create(ctx context.Context, sub *models.Submission, m *repository.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.submissions[sub.ID]; ok {
+		return apperr.Errorf(apperr.ErrConflict, "submission %s already exists", sub.ID)
+	}
+	now := time.Now()
+	sub.CreatedAt, sub.UpdatedAt = now, now
+	s.submissions[sub.ID] = *sub
+
+	if m.Headers == nil {
+		m.Headers = map[string]string{}
+	}
+	m.ID = int64(len(s.outbox) + 1)
+	m.Status = repository.OutboxPending
+	m.CreatedAt, m.NextAttemptAt = now, now
+	s.outbox = append(s.outbox, *m)
+	return nil
+}
+
+func (s *SubmissionStore) Get(ctx context.Context, id string) (*models.Submission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sub, ok := s.submissions[id]
+	if !ok {
+		return nil, apperr.NotFound("submission", pgx.ErrNoRows)
+	}
+	return &sub, nil
+}
+
+// UpdateStatus of an unknown submission does nothing, like the UPDATE
+func (s *SubmissionStore) UpdateStatus(ctx context.Context, id, status, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.submissions[id]
+	if !ok {
+		return nil
+	}
+	sub.Status, sub.Reason, sub.UpdatedAt = status, reason, time.Now()
+	s.submissions[id] = sub
+	return nil
+}
+
+// Outbox returns the messages written so far, oldest first
+func (s *SubmissionStore) Outbox() []repository.OutboxMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]repository.OutboxMessage(nil), s.outbox...)
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/metrics"
+	"github.com/tmozzze/order_checker/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// observe opens a client span for a repository call. The returned func
+// ends the span and records the call duration
+func observe(ctx context.Context, method string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "repository."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "postgresql")),
+	)
+	return ctx, func() {
+		span.End()
+		metrics.ObserveQuery(method, start)
+	}
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+// insertOrderEvent appends e to the order history inside tx
+func insertOrderEvent(ctx context.Context, tx pgx.Tx, e *models.OrderEvent) error {
+	return tx.QueryRow(ctx, `
+		INSERT INTO order_events (order_uid, type, source, actor, submission_id,
+								  kafka_topic, kafka_partition, kafka_offset, payload_hash, diff)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+		RETURNING id, created_at
+	`,
+		e.OrderUID, e.Type, e.Source, e.Actor, e.SubmissionID,
+		e.Topic, e.Partition, e.Offset, e.PayloadHash, e.Diff,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+// Listing the history of an order, oldest first
+func (r *OrderRepository) ListOrderEvents(ctx context.Context, orderUID string) ([]models.OrderEvent, error) {
+	ctx, done := observe(ctx, "Order.ListOrderEvents")
+	defer done()
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, order_uid, type, source, actor, submission_id, kafka_topic,
+			kafka_partition, kafka_offset, payload_hash, diff, created_at
+		FROM order_events
+		WHERE order_uid = $1
+		ORDER BY id
+	`, orderUID)
+	if err != nil {
+		return nil, dbErr("order", err)
+	}
+	defer rows.Close()
+
+	history := []models.OrderEvent{}
+	for rows.Next() {
+		var e models.OrderEvent
+		err := rows.Scan(&e.ID, &e.OrderUID, &e.Type, &e.Source, &e.Actor, &e.SubmissionID,
+			&e.Topic, &e.Partition, &e.Offset, &e.PayloadHash, &e.Diff, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, e)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+const (
+	SortDateDesc = "date_desc"
+	SortDateAsc  = "date_asc"
+
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+var (
+	ErrInvalidCursor = apperr.Errorf(apperr.ErrValidation, "invalid cursor")
+	ErrInvalidSort   = apperr.Errorf(apperr.ErrValidation, "invalid sort")
+)
+
+// OrderFilter describes GET /orders query. Empty fields are ignored
+type OrderFilter struct {
+	CustomerID  string
+	TrackNumber string
+	CreatedFrom time.Time // inclusive
+	CreatedTo   time.Time // exclusive
+	Provider    string
+	Currency    string
+	City        string
+	Brand       string
+	Sort        string
+	Limit       int
+	Cursor      string
+}
+
+type OrderPage struct {
+	Orders     []models.Order `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// Cursor is the (date_created, order_uid) keyset position of the last row
+type Cursor struct {
+	DateCreated time.Time
+	OrderUID    string
+}
+
+func EncodeCursor(o *models.Order) string {
+	raw := o.DateCreated.Format(time.RFC3339Nano) + "|" + o.OrderUID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	ts, uid, ok := strings.Cut(string(raw), "|")
+	if !ok || uid == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{DateCreated: t, OrderUID: uid}, nil
+}
+
+// queryBuilder collects WHERE conditions with positional args
+type queryBuilder struct {
+	conds []string
+	args  []any
+}
+
+func (b *queryBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *queryBuilder) where(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+func (b *queryBuilder) whereClause() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conds, " AND ")
+}
+
+// Listing orders with filters and keyset pagination
+func (r *OrderRepository) ListOrders(ctx context.Context, f OrderFilter) (*OrderPage, error) {
+	ctx, done := observe(ctx, "Order.ListOrders")
+	defer done()
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultListLimit
+	}
+	if f.Limit > MaxListLimit {
+		f.Limit = MaxListLimit
+	}
+
+	var b queryBuilder
+
+	if f.CustomerID != "" {
+		b.where("o.customer_id = " + b.arg(f.CustomerID))
+	}
+	if f.TrackNumber != "" {
+		b.where("o.track_number = " + b.arg(f.TrackNumber))
+	}
+	if !f.CreatedFrom.IsZero() {
+		b.where("o.date_created >= " + b.arg(f.CreatedFrom))
+	}
+	if !f.CreatedTo.IsZero() {
+		b.where("o.date_created < " + b.arg(f.CreatedTo))
+	}
+	if f.Provider != "" {
+		b.where("EXISTS (SELECT 1 FROM payments p WHERE p.order_uid = o.order_uid AND p.provider = " + b.arg(f.Provider) + ")")
+	}
+	if f.Currency != "" {
+		b.where("EXISTS (SELECT 1 FROM payments p WHERE p.order_uid = o.order_uid AND p.currency = " + b.arg(f.Currency) + ")")
+	}
+	if f.City != "" {
+		b.where("EXISTS (SELECT 1 FROM deliveries d WHERE d.order_uid = o.order_uid AND d.city = " + b.arg(f.City) + ")")
+	}
+	if f.Brand != "" {
+		b.where("EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.brand = " + b.arg(f.Brand) + ")")
+	}
+
+	order := "DESC"
+	cmp := "<"
+	switch f.Sort {
+	case "", SortDateDesc:
+	case SortDateAsc:
+		order, cmp = "ASC", ">"
+	default:
+		return nil, ErrInvalidSort
+	}
+
+	if f.Cursor != "" {
+		c, err := DecodeCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		b.where(fmt.Sprintf("(o.date_created, o.order_uid) %s (%s, %s)", cmp, b.arg(c.DateCreated), b.arg(c.OrderUID)))
+	}
+
+	// One extra row tells whether there is a next page
+	query := fmt.Sprintf(`
+		SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+			o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
+			o.status, o.validation
+		FROM orders o
+		%s
+		ORDER BY o.date_created %s, o.order_uid %s
+		LIMIT %s
+	`, b.whereClause(), order, order, b.arg(f.Limit+1))
+
+	orders, err := r.queryOrders(ctx, query, b.args...)
+	if err != nil {
+		return nil, dbErr("order", err)
+	}
+
+	page := &OrderPage{Orders: orders}
+	if len(orders) > f.Limit {
+		page.Orders = orders[:f.Limit]
+		page.NextCursor = EncodeCursor(&page.Orders[f.Limit-1])
+	}
+
+	if err := r.loadOrderDetails(ctx, page.Orders); err != nil {
+		return nil, dbErr("order", err)
+	}
+	if page.Orders == nil {
+		page.Orders = []models.Order{}
+	}
+	return page, nil
+}
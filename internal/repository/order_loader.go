@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+// Default page size for bulk loading
+const defaultPageSize = 500
+
+const orderColumns = `
+	order_uid, track_number, entry, locale, internal_signature,
+	customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard,
+	status, validation
+`
+
+func scanOrder(row pgx.Row, o *models.Order) error {
+	return row.Scan(
+		&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature,
+		&o.CustomerID, &o.DeliveryService, &o.ShardKey, &o.SmID, &o.DateCreated,
+		&o.OofShard, &o.Status, &o.Validation,
+	)
+}
+
+// Getting all orders. Loads the table page by page, prefer ForEachOrderPage
+// for big tables so the whole set is never held in memory
+func (r *OrderRepository) GetAllOrders(ctx context.Context) ([]models.Order, error) {
+	ctx, done := observe(ctx, "Order.GetAllOrders")
+	defer done()
+
+	var orders []models.Order
+	err := r.ForEachOrderPage(ctx, defaultPageSize, func(page []models.Order) error {
+		orders = append(orders, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// ForEachOrderPage streams full order graphs ordered by order_uid.
+// Every page costs four queries regardless of its size
+func (r *OrderRepository) ForEachOrderPage(ctx context.Context, pageSize int, fn func([]models.Order) error) error {
+	ctx, done := observe(ctx, "Order.ForEachOrderPage")
+	defer done()
+
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	query := `SELECT ` + orderColumns + `
+		FROM orders
+		WHERE order_uid > $1
+		ORDER BY order_uid
+		LIMIT $2
+	`
+
+	after := ""
+	for {
+		orders, err := r.queryOrders(ctx, query, after, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+
+		if err := r.loadOrderDetails(ctx, orders); err != nil {
+			return err
+		}
+		if err := fn(orders); err != nil {
+			return err
+		}
+
+		if len(orders) < pageSize {
+			return nil
+		}
+		after = orders[len(orders)-1].OrderUID
+	}
+}
+
+// Getting the most recent orders by date_created, newest first
+func (r *OrderRepository) GetRecentOrders(ctx context.Context, limit, offset int) ([]models.Order, error) {
+	ctx, done := observe(ctx, "Order.GetRecentOrders")
+	defer done()
+
+	query := `SELECT ` + orderColumns + `
+		FROM orders
+		ORDER BY date_created DESC, order_uid DESC
+		LIMIT $1 OFFSET $2
+	`
+	orders, err := r.queryOrders(ctx, query, limit, offset)
+	if err != nil {
+		return nil, dbErr("order", err)
+	}
+
+	if err := r.loadOrderDetails(ctx, orders); err != nil {
+		return nil, dbErr("order", err)
+	}
+	return orders, nil
+}
+
+func (r *OrderRepository) queryOrders(ctx context.Context, query string, args ...any) ([]models.Order, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var o models.Order
+		if err := scanOrder(rows, &o); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// loadOrderDetails fills delivery, payment and items of the given orders
+// with one batched query per child table
+func (r *OrderRepository) loadOrderDetails(ctx context.Context, orders []models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(orders))
+	byID := make(map[string]*models.Order, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].OrderUID
+		byID[orders[i].OrderUID] = &orders[i]
+	}
+
+	// Deliveries
+	rows, err := r.pool.Query(ctx, `
+		SELECT order_uid, name, phone, zip, city, address, region, email
+		FROM deliveries WHERE order_uid = ANY($1)
+	`, ids)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var uid string
+		var d models.Delivery
+		if err := rows.Scan(&uid, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address,
+			&d.Region, &d.Email); err != nil {
+			rows.Close()
+			return err
+		}
+		byID[uid].Delivery = d
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Payments
+	rows, err = r.pool.Query(ctx, `
+		SELECT order_uid, transaction, request_id, currency, provider, amount,
+			payment_dt, bank, delivery_cost, goods_total, custom_fee
+		FROM payments WHERE order_uid = ANY($1)
+	`, ids)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var uid string
+		var p models.Payment
+		if err := rows.Scan(&uid, &p.Transaction, &p.RequestID, &p.Currency,
+			&p.Provider, &p.Amount, &p.PaymentDt, &p.Bank, &p.DeliveryCost,
+			&p.GoodsTotal, &p.CustomFee); err != nil {
+			rows.Close()
+			return err
+		}
+		byID[uid].Payment = p
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Items, ordered by id to keep insertion order
+	rows, err = r.pool.Query(ctx, `
+		SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size,
+			total_price, nm_id, brand, status
+		FROM items WHERE order_uid = ANY($1)
+		ORDER BY id
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid string
+		var item models.Item
+		if err := rows.Scan(&uid, &item.ChrtID, &item.TrackNumber, &item.Price,
+			&item.RID, &item.Name, &item.Sale, &item.Size, &item.TotalPrice,
+			&item.NmID, &item.Brand, &item.Status); err != nil {
+			return err
+		}
+		o := byID[uid]
+		o.Items = append(o.Items, item)
+	}
+	return rows.Err()
+}
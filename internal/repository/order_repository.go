@@ -2,11 +2,34 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tmozzze/order_checker/internal/apperr"
 	"github.com/tmozzze/order_checker/internal/models"
 )
 
+var ErrOrderConflict = errors.New("order already exists with different content")
+
+// OrderConflictError is returned when an order_uid is saved again with
+// a payload that differs from the stored one
+type OrderConflictError struct {
+	OrderUID     string
+	StoredHash   string
+	IncomingHash string
+}
+
+func (e *OrderConflictError) Error() string {
+	return fmt.Sprintf("order %s already exists with different content: stored hash %q, incoming hash %q",
+		e.OrderUID, e.StoredHash, e.IncomingHash)
+}
+
+func (e *OrderConflictError) Is(target error) bool {
+	return target == ErrOrderConflict || target == apperr.ErrConflict
+}
+
 type OrderRepository struct {
 	pool *pgxpool.Pool
 }
@@ -17,10 +40,13 @@ func NewOrderRepository(pool *pgxpool.Pool) *OrderRepository {
 
 // Getting Order struct from Postgres by order ID
 func (r *OrderRepository) GetOrderById(ctx context.Context, orderID string) (*models.Order, error) {
+	ctx, done := observe(ctx, "Order.GetOrderById")
+	defer done()
+
 	// Get order
 	query := `
 		SELECT order_uid, track_number, entry, locale, internal_signature, customer_id,  
-			delivery_service, shardkey, sm_id, date_created, oof_shard
+			delivery_service, shardkey, sm_id, date_created, oof_shard, status, validation
 		FROM orders WHERE order_uid = $1
 	`
 
@@ -30,10 +56,10 @@ func (r *OrderRepository) GetOrderById(ctx context.Context, orderID string) (*mo
 	err := row.Scan(
 		&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature,
 		&o.CustomerID, &o.DeliveryService, &o.ShardKey, &o.SmID, &o.DateCreated,
-		&o.OofShard,
+		&o.OofShard, &o.Status, &o.Validation,
 	)
 	if err != nil {
-		return nil, err
+		return nil, dbErr("order", err)
 	}
 
 	// Get Delivery
@@ -47,7 +73,7 @@ func (r *OrderRepository) GetOrderById(ctx context.Context, orderID string) (*mo
 	var d models.Delivery
 	err = row.Scan(&d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email)
 	if err != nil {
-		return nil, err
+		return nil, dbErr("order", err)
 	}
 
 	// Delivery in Order struct
@@ -67,7 +93,7 @@ func (r *OrderRepository) GetOrderById(ctx context.Context, orderID string) (*mo
 		&p.CustomFee,
 	)
 	if err != nil {
-		return nil, err
+		return nil, dbErr("order", err)
 	}
 
 	// Payment in Order struct
@@ -82,7 +108,7 @@ func (r *OrderRepository) GetOrderById(ctx context.Context, orderID string) (*mo
 
 	rows, err := r.pool.Query(ctx, queryItems, orderID)
 	if err != nil {
-		return nil, err
+		return nil, dbErr("order", err)
 	}
 	defer rows.Close()
 
@@ -94,7 +120,7 @@ func (r *OrderRepository) GetOrderById(ctx context.Context, orderID string) (*mo
 			&item.Brand, &item.Status,
 		)
 		if err != nil {
-			return nil, err
+			return nil, dbErr("order", err)
 		}
 
 		// Item to slice Items in Order struct
@@ -105,26 +131,39 @@ func (r *OrderRepository) GetOrderById(ctx context.Context, orderID string) (*mo
 
 }
 
-func (r *OrderRepository) SaveOrder(ctx context.Context, o *models.Order) error {
+// Saving order with all its parts in one transaction. Saving the same
+// order again is a no-op, saving different content under a known
+// order_uid returns *OrderConflictError. o.Status is set to the stored
+// status. Every call is recorded in the order history with src
+func (r *OrderRepository) SaveOrder(ctx context.Context, o *models.Order, src models.EventSource) error {
+	ctx, done := observe(ctx, "Order.SaveOrder")
+	defer done()
+
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		return err
+		return dbErr("order", err)
 	}
 	defer tx.Rollback(ctx)
 
-	// Insert Order
-	_, err = tx.Exec(ctx, `
+	// Insert Order, a redelivered order_uid inserts nothing
+	hash := o.ContentHash()
+	tag, err := tx.Exec(ctx, `
 		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, 
 							customer_id, delivery_service, shardkey, sm_id,
-							date_created, oof_shard)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+							date_created, oof_shard, payload_hash, validation)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
+		ON CONFLICT (order_uid) DO NOTHING
 		`,
 		o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature, o.CustomerID,
-		o.DeliveryService, o.ShardKey, o.SmID, o.DateCreated, o.OofShard,
+		o.DeliveryService, o.ShardKey, o.SmID, o.DateCreated, o.OofShard, hash, o.Validation,
 	)
 	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return r.checkDuplicate(ctx, tx, o, hash, src)
+	}
+	o.Status = models.StatusCreated
 
 	// Insert Delivery
 	_, err = tx.Exec(ctx, `
@@ -169,117 +208,56 @@ func (r *OrderRepository) SaveOrder(ctx context.Context, o *models.Order) error
 		}
 	}
 
+	err = insertOrderEvent(ctx, tx, &models.OrderEvent{
+		OrderUID:    o.OrderUID,
+		Type:        models.OrderEventReceived,
+		EventSource: src,
+		PayloadHash: hash,
+	})
+	if err != nil {
+		return err
+	}
+
 	return tx.Commit(ctx)
 }
 
-func (r *OrderRepository) GetAllOrders(ctx context.Context) ([]models.Order, error) {
-	// Order
-	query := `
-			SELECT order_uid, track_number, entry, locale, internal_signature, 
-		       customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-			FROM orders
-		`
-	rows, err := r.pool.Query(ctx, query)
+// checkDuplicate compares the stored payload hash with the incoming one
+// and records a redelivery or a conflict
+func (r *OrderRepository) checkDuplicate(ctx context.Context, tx pgx.Tx, o *models.Order, hash string, src models.EventSource) error {
+	var stored *string
+	var status models.OrderStatus
+	err := tx.QueryRow(ctx, `SELECT payload_hash, status FROM orders WHERE order_uid = $1`, o.OrderUID).Scan(&stored, &status)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	var orders []models.Order
-	for rows.Next() {
-		var order models.Order
-		if err := rows.Scan(
-			&order.OrderUID,
-			&order.TrackNumber,
-			&order.Entry,
-			&order.Locale,
-			&order.InternalSignature,
-			&order.CustomerID,
-			&order.DeliveryService,
-			&order.ShardKey,
-			&order.SmID,
-			&order.DateCreated,
-			&order.OofShard,
-		); err != nil {
-			return nil, err
-		}
-		// Delivery
-		query = `
-			SELECT name, phone, zip, city, address, region, email
-			FROM deliveries
-			WHERE order_uid = $1
-		`
-		err = r.pool.QueryRow(ctx, query, order.OrderUID).Scan(
-			&order.Delivery.Name,
-			&order.Delivery.Phone,
-			&order.Delivery.Zip,
-			&order.Delivery.City,
-			&order.Delivery.Address,
-			&order.Delivery.Region,
-			&order.Delivery.Email,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		// Payment
-		query = `
-			SELECT transaction, request_id, currency, provider, amount,
-	       			payment_dt, bank, delivery_cost, goods_total, custom_fee
-			FROM payments
-			WHERE order_uid = $1
-		`
-		err = r.pool.QueryRow(ctx, query, order.OrderUID).Scan(
-			&order.Payment.Transaction,
-			&order.Payment.RequestID,
-			&order.Payment.Currency,
-			&order.Payment.Provider,
-			&order.Payment.Amount,
-			&order.Payment.PaymentDt,
-			&order.Payment.Bank,
-			&order.Payment.DeliveryCost,
-			&order.Payment.GoodsTotal,
-			&order.Payment.CustomFee,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		// Items
-		query = `
-			SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
-			FROM items
-			WHERE order_uid = $1
-		`
-
-		itemRows, err := r.pool.Query(ctx, query, order.OrderUID)
-		if err != nil {
-			return nil, err
+	// Rows saved before hashing have no hash and can't be proven identical
+	e := &models.OrderEvent{OrderUID: o.OrderUID, EventSource: src, PayloadHash: hash}
+	if stored != nil && *stored == hash {
+		o.Status = status
+		e.Type = models.OrderEventRedelivered
+		if err := insertOrderEvent(ctx, tx, e); err != nil {
+			return err
 		}
+		return tx.Commit(ctx)
+	}
 
-		for itemRows.Next() {
-			var item models.Item
-			if err := itemRows.Scan(
-				&item.ChrtID,
-				&item.TrackNumber,
-				&item.Price,
-				&item.RID,
-				&item.Name,
-				&item.Sale,
-				&item.Size,
-				&item.TotalPrice,
-				&item.NmID,
-				&item.Brand,
-				&item.Status,
-			); err != nil {
-				itemRows.Close()
-				return nil, err
-			}
-			order.Items = append(order.Items, item)
-		}
-		itemRows.Close()
+	// Keep what the rejected payload would have changed. Orders that can't
+	// be loaded whole are recorded without a diff
+	e.Type = models.OrderEventConflict
+	if current, err := r.GetOrderById(ctx, o.OrderUID); err == nil {
+		e.Diff = models.Diff(current, o)
+	}
+	if err := insertOrderEvent(ctx, tx, e); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
 
-		orders = append(orders, order)
+	conflict := &OrderConflictError{OrderUID: o.OrderUID, IncomingHash: hash}
+	if stored != nil {
+		conflict.StoredHash = *stored
 	}
-	return orders, nil
+	return conflict
 }
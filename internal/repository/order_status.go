@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+// ErrStatusChanged means the order left the expected status between the
+// read and the update
+var ErrStatusChanged = apperr.Errorf(apperr.ErrConflict, "order status changed concurrently")
+
+// Getting the current status of an order, apperr.ErrNotFound if there is none
+func (r *OrderRepository) GetOrderStatus(ctx context.Context, orderUID string) (models.OrderStatus, error) {
+	ctx, done := observe(ctx, "Order.GetOrderStatus")
+	defer done()
+
+	var status models.OrderStatus
+	err := r.pool.QueryRow(ctx, `SELECT status FROM orders WHERE order_uid = $1`, orderUID).Scan(&status)
+	return status, dbErr("order", err)
+}
+
+// UpdateStatus moves the order from c.From to c.To and records the change
+// and the history event in one transaction. Returns ErrStatusChanged if the
+// order is no longer in c.From, so concurrent updates can't skip the
+// transition check
+func (r *OrderRepository) UpdateStatus(ctx context.Context, c *models.StatusChange, src models.EventSource) error {
+	ctx, done := observe(ctx, "Order.UpdateStatus")
+	defer done()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return dbErr("order", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE orders SET status = $3 WHERE order_uid = $1 AND status = $2
+	`, c.OrderUID, c.From, c.To)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrStatusChanged
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO order_status_changes (order_uid, from_status, to_status, actor, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, changed_at
+	`, c.OrderUID, c.From, c.To, c.Actor, c.Reason).Scan(&c.ID, &c.ChangedAt)
+	if err != nil {
+		return err
+	}
+
+	err = insertOrderEvent(ctx, tx, &models.OrderEvent{
+		OrderUID:    c.OrderUID,
+		Type:        models.OrderEventStatusChanged,
+		EventSource: src,
+		Diff:        []models.FieldChange{{Path: "status", From: c.From, To: c.To}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Listing the status changes of an order, oldest first
+func (r *OrderRepository) ListStatusChanges(ctx context.Context, orderUID string) ([]models.StatusChange, error) {
+	ctx, done := observe(ctx, "Order.ListStatusChanges")
+	defer done()
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, order_uid, from_status, to_status, actor, reason, changed_at
+		FROM order_status_changes
+		WHERE order_uid = $1
+		ORDER BY id
+	`, orderUID)
+	if err != nil {
+		return nil, dbErr("order", err)
+	}
+	defer rows.Close()
+
+	changes := []models.StatusChange{}
+	for rows.Next() {
+		var c models.StatusChange
+		if err := rows.Scan(&c.ID, &c.OrderUID, &c.From, &c.To, &c.Actor, &c.Reason, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Outbox row statuses
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+type OutboxMessage struct {
+	ID            int64             `json:"id"`
+	OrderUID      string            `json:"order_uid"`
+	Topic         string            `json:"topic"`
+	Payload       []byte            `json:"-"`
+	Headers       map[string]string `json:"headers"`
+	Status        string            `json:"status"`
+	Attempts      int               `json:"attempts"`
+	LastError     *string           `json:"last_error,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	NextAttemptAt time.Time         `json:"next_attempt_at"`
+	SentAt        *time.Time        `json:"sent_at,omitempty"`
+}
+
+// PublishResult tells the outbox what happened to one claimed message
+type PublishResult struct {
+	Err     error
+	RetryAt time.Time
+	GiveUp  bool
+}
+
+type OutboxRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewOutboxRepository(pool *pgxpool.Pool) *OutboxRepository {
+	return &OutboxRepository{pool: pool}
+}
+
+const outboxColumns = `
+	id, order_uid, topic, payload, headers, status, attempts, last_error,
+	created_at, next_attempt_at, sent_at
+`
+
+func scanOutbox(row pgx.Row, m *OutboxMessage) error {
+	return row.Scan(&m.ID, &m.OrderUID, &m.Topic, &m.Payload, &m.Headers, &m.Status,
+		&m.Attempts, &m.LastError, &m.CreatedAt, &m.NextAttemptAt, &m.SentAt)
+}
+
+// addOutbox adds m to the outbox within the caller's transaction, see
+// SubmissionRepository.Create
+func addOutbox(ctx context.Context, q interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}, m *OutboxMessage) error {
+	if m.Headers == nil {
+		m.Headers = map[string]string{}
+	}
+	return q.QueryRow(ctx, `
+		INSERT INTO outbox (order_uid, topic, payload, headers)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, m.OrderUID, m.Topic, m.Payload, m.Headers).Scan(&m.ID, &m.CreatedAt)
+}
+
+// ProcessPending claims up to limit ready messages and hands them to publish.
+// Only the oldest pending message of every order_uid is claimed, so
+// messages of one order are published strictly in order. Rows stay locked
+// until publish returns, which lets several relays run side by side
+func (r *OutboxRepository) ProcessPending(ctx context.Context, limit int,
+	publish func(ctx context.Context, msgs []OutboxMessage) []PublishResult) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT `+outboxColumns+`
+		FROM outbox
+		WHERE status = 'pending'
+			AND next_attempt_at <= now()
+			AND id IN (SELECT min(id) FROM outbox WHERE status = 'pending' GROUP BY order_uid)
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var msgs []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := scanOutbox(rows, &m); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		msgs = append(msgs, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	results := publish(ctx, msgs)
+
+	sent := 0
+	for i, m := range msgs {
+		res := results[i]
+		if res.Err == nil {
+			_, err = tx.Exec(ctx, `
+				UPDATE outbox SET status = 'sent', attempts = attempts + 1, sent_at = now(), last_error = NULL
+				WHERE id = $1
+			`, m.ID)
+			sent++
+		} else {
+			status := OutboxPending
+			if res.GiveUp {
+				status = OutboxFailed
+			}
+			_, err = tx.Exec(ctx, `
+				UPDATE outbox SET status = $2, attempts = attempts + 1, last_error = $3, next_attempt_at = $4
+				WHERE id = $1
+			`, m.ID, status, res.Err.Error(), res.RetryAt)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return sent, tx.Commit(ctx)
+}
+
+// Listing failed messages or pending ones older than stuckAfter
+func (r *OutboxRepository) ListProblems(ctx context.Context, status string, stuckAfter time.Duration, limit int) ([]OutboxMessage, error) {
+	ctx, done := observe(ctx, "Outbox.ListProblems")
+	defer done()
+
+	var rows pgx.Rows
+	var err error
+
+	switch status {
+	case OutboxFailed:
+		rows, err = r.pool.Query(ctx, `
+			SELECT `+outboxColumns+` FROM outbox
+			WHERE status = 'failed'
+			ORDER BY id DESC LIMIT $1
+		`, limit)
+	default:
+		rows, err = r.pool.Query(ctx, `
+			SELECT `+outboxColumns+` FROM outbox
+			WHERE status = 'pending' AND created_at < now() - $1::interval
+			ORDER BY id LIMIT $2
+		`, stuckAfter, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := []OutboxMessage{}
+	for rows.Next() {
+		var m OutboxMessage
+		if err := scanOutbox(rows, &m); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// Retry puts a failed message back to pending. Returns false if there is
+// no failed message with this id
+func (r *OutboxRepository) Retry(ctx context.Context, id int64) (bool, error) {
+	ctx, done := observe(ctx, "Outbox.Retry")
+	defer done()
+
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE outbox SET status = 'pending', attempts = 0, next_attempt_at = now()
+		WHERE id = $1 AND status = 'failed'
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
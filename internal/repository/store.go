@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+// OrderStore is the order storage used by the service, the consumer and
+// the cache warm-up. OrderRepository keeps it in Postgres, memory.OrderStore
+// in process. Both report unknown orders with apperr.ErrNotFound wrapping
+// pgx.ErrNoRows and pass the conformance tests in repository/storetest
+type OrderStore interface {
+	GetOrderById(ctx context.Context, orderID string) (*models.Order, error)
+	SaveOrder(ctx context.Context, o *models.Order, src models.EventSource) error
+	ListOrders(ctx context.Context, f OrderFilter) (*OrderPage, error)
+	GetRecentOrders(ctx context.Context, limit, offset int) ([]models.Order, error)
+
+	GetOrderStatus(ctx context.Context, orderUID string) (models.OrderStatus, error)
+	UpdateStatus(ctx context.Context, c *models.StatusChange, src models.EventSource) error
+	ListStatusChanges(ctx context.Context, orderUID string) ([]models.StatusChange, error)
+	ListOrderEvents(ctx context.Context, orderUID string) ([]models.OrderEvent, error)
+}
+
+var _ OrderStore = (*OrderRepository)(nil)
+
+// SubmissionStore keeps POST /orders submissions. Create writes the
+// outbox message in the same transaction. SubmissionRepository keeps them
+// in Postgres, memory.SubmissionStore in process
+type SubmissionStore interface {
+	Create(ctx context.Context, s *models.Submission, m *OutboxMessage) error
+	Get(ctx context.Context, id string) (*models.Submission, error)
+	UpdateStatus(ctx context.Context, id, status, reason string) error
+}
+
+var _ SubmissionStore = (*SubmissionRepository)(nil)
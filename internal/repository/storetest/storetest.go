@@ -0,0 +1,324 @@
+// Package storetest holds conformance tests every repository.OrderStore
+// and repository.SubmissionStore must pass. Test data is unique per run,
+// so a shared database works
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/models"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+var source = models.EventSource{Source: models.SourceKafka, Actor: "storetest"}.FromMessage("orders", 0, 42)
+
+// Run runs the conformance tests against the store returned by newStore
+func Run(t *testing.T, newStore func(t *testing.T) repository.OrderStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s repository.OrderStore)
+	}{
+		{"SaveAndGet", testSaveAndGet},
+		{"NotFound", testNotFound},
+		{"Redelivery", testRedelivery},
+		{"Conflict", testConflict},
+		{"ListOrders", testListOrders},
+		{"ListOrdersErrors", testListOrdersErrors},
+		{"Status", testStatus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// Order returns a valid order with a unique order_uid made from prefix
+func Order(prefix string) *models.Order {
+	uid := fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
+	return &models.Order{
+		OrderUID:    uid,
+		TrackNumber: "TN-" + uid,
+		Entry:       "WBIL",
+		Locale:      "en",
+		CustomerID:  "customer-" + uid,
+		Delivery:    models.Delivery{Name: "Test User", City: "Haifa"},
+		Payment: models.Payment{
+			Transaction: "trx-" + uid, Currency: "USD", Provider: "visa",
+			Amount: 110, DeliveryCost: 10, GoodsTotal: 100,
+		},
+		Items: []models.Item{
+			{ChrtID: 1, TrackNumber: "TN-" + uid, Price: 100, TotalPrice: 100, Brand: "NoName"},
+		},
+		DateCreated: time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+func testSaveAndGet(t *testing.T, s repository.OrderStore) {
+	ctx := context.Background()
+	order := Order("save")
+	order.Validation = &models.ValidationReport{
+		Profile:  "legacy",
+		Warnings: []apperr.FieldError{{Field: "delivery.phone", Message: "must be an E.164 number", Rule: "phone"}},
+	}
+
+	if err := s.SaveOrder(ctx, order, source); err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != models.StatusCreated {
+		t.Fatalf("saved order status %q, want %q", order.Status, models.StatusCreated)
+	}
+
+	got, err := s.GetOrderById(ctx, order.OrderUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ContentHash() != order.ContentHash() || got.Status != models.StatusCreated {
+		t.Fatalf("stored order differs:\ngot  %+v\nwant %+v", got, order)
+	}
+	if v := got.Validation; v == nil || v.Profile != "legacy" || len(v.Warnings) != 1 || v.Warnings[0] != order.Validation.Warnings[0] {
+		t.Fatalf("validation report not stored: %+v", v)
+	}
+
+	// The caller's copy is not shared with the store
+	got.Items[0].Price = 1
+	again, err := s.GetOrderById(ctx, order.OrderUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Items[0].Price != order.Items[0].Price {
+		t.Fatal("changing a returned order changed the stored one")
+	}
+}
+
+func testNotFound(t *testing.T, s repository.OrderStore) {
+	ctx := context.Background()
+	uid := Order("missing").OrderUID
+
+	if _, err := s.GetOrderById(ctx, uid); !errors.Is(err, apperr.ErrNotFound) || !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("GetOrderById: expected apperr.ErrNotFound wrapping pgx.ErrNoRows, got %v", err)
+	}
+	if _, err := s.GetOrderStatus(ctx, uid); !errors.Is(err, apperr.ErrNotFound) || !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("GetOrderStatus: expected apperr.ErrNotFound wrapping pgx.ErrNoRows, got %v", err)
+	}
+	history, err := s.ListOrderEvents(ctx, uid)
+	if err != nil || history == nil || len(history) != 0 {
+		t.Fatalf("ListOrderEvents: expected empty history, got %v, %v", history, err)
+	}
+}
+
+func testRedelivery(t *testing.T, s repository.OrderStore) {
+	ctx := context.Background()
+	order := Order("redelivery")
+
+	for i := range 3 {
+		if err := s.SaveOrder(ctx, order, source); err != nil {
+			t.Fatalf("delivery %d: %v", i+1, err)
+		}
+	}
+
+	got, err := s.GetOrderById(ctx, order.OrderUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Items) != len(order.Items) {
+		t.Fatalf("items duplicated: got %d, want %d", len(got.Items), len(order.Items))
+	}
+
+	assertHistory(t, s, order.OrderUID,
+		models.OrderEventReceived, models.OrderEventRedelivered, models.OrderEventRedelivered)
+}
+
+func testConflict(t *testing.T, s repository.OrderStore) {
+	ctx := context.Background()
+	order := Order("conflict")
+
+	if err := s.SaveOrder(ctx, order, source); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := *order
+	changed.Payment.Amount++
+	err := s.SaveOrder(ctx, &changed, source)
+
+	var conflict *repository.OrderConflictError
+	if !errors.Is(err, repository.ErrOrderConflict) || !errors.Is(err, apperr.ErrConflict) || !errors.As(err, &conflict) {
+		t.Fatalf("expected *OrderConflictError, got %v", err)
+	}
+	if conflict.StoredHash != order.ContentHash() || conflict.IncomingHash != changed.ContentHash() {
+		t.Fatalf("unexpected hashes in %v", conflict)
+	}
+
+	// The original payload is still accepted
+	if err := s.SaveOrder(ctx, order, source); err != nil {
+		t.Fatalf("replay of original: %v", err)
+	}
+
+	history := assertHistory(t, s, order.OrderUID,
+		models.OrderEventReceived, models.OrderEventConflict, models.OrderEventRedelivered)
+	if d := history[1].Diff; len(d) != 1 || d[0].Path != "payment.amount" {
+		t.Fatalf("unexpected conflict diff %+v", d)
+	}
+	if e := history[0]; e.PayloadHash != order.ContentHash() || e.Offset == nil || *e.Offset != 42 {
+		t.Fatalf("unexpected received event %+v", e)
+	}
+}
+
+func testListOrders(t *testing.T, s repository.OrderStore) {
+	ctx := context.Background()
+
+	// Five orders of one customer a minute apart, the middle one by another brand
+	customer := Order("list").CustomerID
+	base := time.Now().UTC().Truncate(time.Microsecond)
+	var uids []string
+	for i := range 5 {
+		o := Order(fmt.Sprintf("list%d", i))
+		o.CustomerID = customer
+		o.DateCreated = base.Add(time.Duration(i) * time.Minute)
+		if i == 2 {
+			o.Items[0].Brand = "Other"
+		}
+		if err := s.SaveOrder(ctx, o, source); err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, o.OrderUID)
+	}
+
+	// Newest first, two per page
+	var got []string
+	f := repository.OrderFilter{CustomerID: customer, Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination does not end")
+		}
+		page, err := s.ListOrders(ctx, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range page.Orders {
+			got = append(got, o.OrderUID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		f.Cursor = page.NextCursor
+	}
+	want := []string{uids[4], uids[3], uids[2], uids[1], uids[0]}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("desc pages: got %v, want %v", got, want)
+	}
+
+	page, err := s.ListOrders(ctx, repository.OrderFilter{
+		CustomerID:  customer,
+		Sort:        repository.SortDateAsc,
+		CreatedFrom: base.Add(time.Minute),
+		CreatedTo:   base.Add(4 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Orders) != 3 || page.Orders[0].OrderUID != uids[1] || page.NextCursor != "" {
+		t.Fatalf("asc date range: got %d orders starting %v", len(page.Orders), page.Orders)
+	}
+	if len(page.Orders[0].Items) == 0 {
+		t.Fatal("listed orders have no items")
+	}
+
+	page, err = s.ListOrders(ctx, repository.OrderFilter{CustomerID: customer, Brand: "Other", Provider: "visa", City: "Haifa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Orders) != 1 || page.Orders[0].OrderUID != uids[2] {
+		t.Fatalf("brand filter: got %v", page.Orders)
+	}
+
+	page, err = s.ListOrders(ctx, repository.OrderFilter{CustomerID: customer, Currency: "EUR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Orders == nil || len(page.Orders) != 0 {
+		t.Fatalf("expected an empty, non-nil page, got %#v", page.Orders)
+	}
+}
+
+func testListOrdersErrors(t *testing.T, s repository.OrderStore) {
+	ctx := context.Background()
+
+	if _, err := s.ListOrders(ctx, repository.OrderFilter{Sort: "random"}); !errors.Is(err, repository.ErrInvalidSort) {
+		t.Fatalf("expected ErrInvalidSort, got %v", err)
+	}
+	if _, err := s.ListOrders(ctx, repository.OrderFilter{Cursor: "not a cursor"}); !errors.Is(err, repository.ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func testStatus(t *testing.T, s repository.OrderStore) {
+	ctx := context.Background()
+	order := Order("status")
+	if err := s.SaveOrder(ctx, order, source); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &models.StatusChange{OrderUID: order.OrderUID, From: models.StatusCreated, To: models.StatusPaid, Actor: "storetest"}
+	if err := s.UpdateStatus(ctx, c, source); err != nil {
+		t.Fatal(err)
+	}
+	if c.ID == 0 || c.ChangedAt.IsZero() {
+		t.Fatalf("change not filled: %+v", c)
+	}
+
+	// A second writer still expecting created loses
+	stale := &models.StatusChange{OrderUID: order.OrderUID, From: models.StatusCreated, To: models.StatusCancelled, Actor: "storetest"}
+	if err := s.UpdateStatus(ctx, stale, source); !errors.Is(err, repository.ErrStatusChanged) || !errors.Is(err, apperr.ErrConflict) {
+		t.Fatalf("expected ErrStatusChanged, got %v", err)
+	}
+
+	status, err := s.GetOrderStatus(ctx, order.OrderUID)
+	if err != nil || status != models.StatusPaid {
+		t.Fatalf("status %q, %v, want paid", status, err)
+	}
+	got, err := s.GetOrderById(ctx, order.OrderUID)
+	if err != nil || got.Status != models.StatusPaid {
+		t.Fatalf("order status %q, %v, want paid", got.Status, err)
+	}
+
+	// Saving the same payload again keeps the status
+	if err := s.SaveOrder(ctx, order, source); err != nil || order.Status != models.StatusPaid {
+		t.Fatalf("redelivery after status change: status %q, %v", order.Status, err)
+	}
+
+	changes, err := s.ListStatusChanges(ctx, order.OrderUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].To != models.StatusPaid || changes[0].Actor != "storetest" {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+
+	assertHistory(t, s, order.OrderUID,
+		models.OrderEventReceived, models.OrderEventStatusChanged, models.OrderEventRedelivered)
+}
+
+func assertHistory(t *testing.T, s repository.OrderStore, uid string, want ...models.OrderEventType) []models.OrderEvent {
+	t.Helper()
+
+	history, err := s.ListOrderEvents(context.Background(), uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != len(want) {
+		t.Fatalf("got %d history events, want %d: %+v", len(history), len(want), history)
+	}
+	for i, e := range history {
+		if e.Type != want[i] || e.Source != source.Source || e.Actor != source.Actor {
+			t.Fatalf("event %d: got %s from %s/%s, want %s", i, e.Type, e.Source, e.Actor, want[i])
+		}
+	}
+	return history
+}
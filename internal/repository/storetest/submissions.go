@@ -0,0 +1,85 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/models"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+// RunSubmissions runs the conformance tests against the store returned
+// by newStore
+func RunSubmissions(t *testing.T, newStore func(t *testing.T) repository.SubmissionStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s repository.SubmissionStore)
+	}{
+		{"CreateAndGet", testSubmissionCreateAndGet},
+		{"NotFound", testSubmissionNotFound},
+		{"UpdateStatus", testSubmissionUpdateStatus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func newSubmission(t *testing.T, s repository.SubmissionStore) *models.Submission {
+	t.Helper()
+	uid := fmt.Sprintf("submission-%d", time.Now().UnixNano())
+	sub := &models.Submission{ID: "sub-" + uid, OrderUID: uid, Status: models.SubmissionQueued}
+	m := &repository.OutboxMessage{OrderUID: uid, Topic: "orders", Payload: []byte(`{}`)}
+
+	if err := s.Create(context.Background(), sub, m); err != nil {
+		t.Fatal(err)
+	}
+	if sub.CreatedAt.IsZero() || m.ID == 0 || m.CreatedAt.IsZero() {
+		t.Fatalf("created submission %+v or outbox message %+v not filled in", sub, m)
+	}
+	return sub
+}
+
+func testSubmissionCreateAndGet(t *testing.T, s repository.SubmissionStore) {
+	sub := newSubmission(t, s)
+
+	got, err := s.Get(context.Background(), sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.OrderUID != sub.OrderUID || got.Status != models.SubmissionQueued {
+		t.Fatalf("stored submission differs: %+v", got)
+	}
+}
+
+func testSubmissionNotFound(t *testing.T, s repository.SubmissionStore) {
+	_, err := s.Get(context.Background(), "missing-submission")
+	if !errors.Is(err, apperr.ErrNotFound) || !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("expected apperr.ErrNotFound wrapping pgx.ErrNoRows, got %v", err)
+	}
+	if err := s.UpdateStatus(context.Background(), "missing-submission", models.SubmissionPersisted, ""); err != nil {
+		t.Fatalf("UpdateStatus of an unknown submission: %v", err)
+	}
+}
+
+func testSubmissionUpdateStatus(t *testing.T, s repository.SubmissionStore) {
+	ctx := context.Background()
+	sub := newSubmission(t, s)
+
+	if err := s.UpdateStatus(ctx, sub.ID, models.SubmissionRejected, "bad payload"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.SubmissionRejected || got.Reason != "bad payload" {
+		t.Fatalf("status not updated: %+v", got)
+	}
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+type SubmissionRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewSubmissionRepository(pool *pgxpool.Pool) *SubmissionRepository {
+	return &SubmissionRepository{pool: pool}
+}
+
+// Create stores a queued submission and its outbox message in one transaction
+func (r *SubmissionRepository) Create(ctx context.Context, s *models.Submission, m *OutboxMessage) error {
+	ctx, done := observe(ctx, "Submission.Create")
+	defer done()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return dbErr("submission", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO submissions (id, order_uid, status)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, updated_at
+	`, s.ID, s.OrderUID, s.Status).Scan(&s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return dbErr("submission", err)
+	}
+
+	if err := addOutbox(ctx, tx, m); err != nil {
+		return dbErr("submission", err)
+	}
+
+	return dbErr("submission", tx.Commit(ctx))
+}
+
+// Getting submission by id
+func (r *SubmissionRepository) Get(ctx context.Context, id string) (*models.Submission, error) {
+	ctx, done := observe(ctx, "Submission.Get")
+	defer done()
+
+	var s models.Submission
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, order_uid, status, reason, created_at, updated_at
+		FROM submissions WHERE id = $1
+	`, id).Scan(&s.ID, &s.OrderUID, &s.Status, &s.Reason, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, dbErr("submission", err)
+	}
+	return &s, nil
+}
+
+func (r *SubmissionRepository) UpdateStatus(ctx context.Context, id, status, reason string) error {
+	ctx, done := observe(ctx, "Submission.UpdateStatus")
+	defer done()
+
+	_, err := r.pool.Exec(ctx, `
+		UPDATE submissions SET status = $2, reason = $3, updated_at = now()
+		WHERE id = $1
+	`, id, status, reason)
+	return dbErr("submission", err)
+}
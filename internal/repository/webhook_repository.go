@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookDead      = "dead"
+)
+
+type WebhookSubscription struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	OrderUID       string          `json:"order_uid"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+
+	// Target of the delivery, filled when claimed for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// DeliveryResult tells the repository what happened to one claimed delivery
+type DeliveryResult struct {
+	Err            error
+	ResponseStatus int // 0 when no response was received
+	RetryAt        time.Time
+	GiveUp         bool
+}
+
+type WebhookRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookRepository(pool *pgxpool.Pool) *WebhookRepository {
+	return &WebhookRepository{pool: pool}
+}
+
+const webhookSubscriptionColumns = `id, url, secret, event_types, active, created_at, updated_at`
+
+func scanWebhookSubscription(row pgx.Row, s *WebhookSubscription) error {
+	return row.Scan(&s.ID, &s.URL, &s.Secret, &s.EventTypes, &s.Active, &s.CreatedAt, &s.UpdatedAt)
+}
+
+const webhookDeliveryColumns = `
+	d.id, d.subscription_id, d.event_id, d.event_type, d.order_uid, d.payload,
+	d.status, d.attempts, d.response_status, d.last_error, d.created_at,
+	d.next_attempt_at, d.delivered_at
+`
+
+func scanWebhookDelivery(row pgx.Row, d *WebhookDelivery, extra ...any) error {
+	return row.Scan(append([]any{&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType,
+		&d.OrderUID, &d.Payload, &d.Status, &d.Attempts, &d.ResponseStatus,
+		&d.LastError, &d.CreatedAt, &d.NextAttemptAt, &d.DeliveredAt}, extra...)...)
+}
+
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, s *WebhookSubscription) error {
+	ctx, done := observe(ctx, "Webhook.CreateSubscription")
+	defer done()
+
+	if s.EventTypes == nil {
+		s.EventTypes = []string{}
+	}
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO webhook_subscriptions (url, secret, event_types, active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`, s.URL, s.Secret, s.EventTypes, s.Active).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+	return dbErr("webhook", err)
+}
+
+func (r *WebhookRepository) ListSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	ctx, done := observe(ctx, "Webhook.ListSubscriptions")
+	defer done()
+
+	rows, err := r.pool.Query(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, dbErr("webhook", err)
+	}
+	defer rows.Close()
+
+	subs := []WebhookSubscription{}
+	for rows.Next() {
+		var s WebhookSubscription
+		if err := scanWebhookSubscription(rows, &s); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// Getting a subscription, apperr.ErrNotFound if there is none
+func (r *WebhookRepository) GetSubscription(ctx context.Context, id int64) (*WebhookSubscription, error) {
+	ctx, done := observe(ctx, "Webhook.GetSubscription")
+	defer done()
+
+	var s WebhookSubscription
+	err := scanWebhookSubscription(r.pool.QueryRow(ctx, `
+		SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions WHERE id = $1
+	`, id), &s)
+	if err != nil {
+		return nil, dbErr("webhook", err)
+	}
+	return &s, nil
+}
+
+// UpdateSubscription overwrites url, secret, event types and active flag.
+// apperr.ErrNotFound if there is no such subscription
+func (r *WebhookRepository) UpdateSubscription(ctx context.Context, s *WebhookSubscription) error {
+	ctx, done := observe(ctx, "Webhook.UpdateSubscription")
+	defer done()
+
+	if s.EventTypes == nil {
+		s.EventTypes = []string{}
+	}
+	err := r.pool.QueryRow(ctx, `
+		UPDATE webhook_subscriptions
+		SET url = $2, secret = $3, event_types = $4, active = $5, updated_at = now()
+		WHERE id = $1
+		RETURNING created_at, updated_at
+	`, s.ID, s.URL, s.Secret, s.EventTypes, s.Active).Scan(&s.CreatedAt, &s.UpdatedAt)
+	return dbErr("webhook", err)
+}
+
+// DeleteSubscription removes the subscription and its delivery history.
+// Returns false if there was none
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, id int64) (bool, error) {
+	ctx, done := observe(ctx, "Webhook.DeleteSubscription")
+	defer done()
+
+	tag, err := r.pool.Exec(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return false, dbErr("webhook", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Enqueue creates a pending delivery for every active subscription that
+// wants eventType. Returns how many were created
+func (r *WebhookRepository) Enqueue(ctx context.Context, eventID, eventType, orderUID string, payload []byte) (int, error) {
+	ctx, done := observe(ctx, "Webhook.Enqueue")
+	defer done()
+
+	tag, err := r.pool.Exec(ctx, `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, order_uid, payload)
+		SELECT id, $1, $2, $3, $4
+		FROM webhook_subscriptions
+		WHERE active AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+	`, eventID, eventType, orderUID, payload)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ProcessDue claims up to limit due deliveries of active subscriptions and
+// hands them to deliver. Rows stay locked until deliver returns, so several
+// senders can run side by side
+func (r *WebhookRepository) ProcessDue(ctx context.Context, limit int,
+	deliver func(ctx context.Context, ds []WebhookDelivery) []DeliveryResult) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT `+webhookDeliveryColumns+`, s.url, s.secret
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= now() AND s.active
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT $1
+		FOR UPDATE OF d SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var ds []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := scanWebhookDelivery(rows, &d, &d.URL, &d.Secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ds = append(ds, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ds) == 0 {
+		return 0, nil
+	}
+
+	results := deliver(ctx, ds)
+
+	delivered := 0
+	for i, d := range ds {
+		res := results[i]
+		var respStatus *int
+		if res.ResponseStatus != 0 {
+			respStatus = &res.ResponseStatus
+		}
+
+		if res.Err == nil {
+			_, err = tx.Exec(ctx, `
+				UPDATE webhook_deliveries
+				SET status = 'delivered', attempts = attempts + 1, response_status = $2,
+					last_error = NULL, delivered_at = now()
+				WHERE id = $1
+			`, d.ID, respStatus)
+			delivered++
+		} else {
+			status := WebhookPending
+			if res.GiveUp {
+				status = WebhookDead
+			}
+			_, err = tx.Exec(ctx, `
+				UPDATE webhook_deliveries
+				SET status = $2, attempts = attempts + 1, response_status = $3,
+					last_error = $4, next_attempt_at = $5
+				WHERE id = $1
+			`, d.ID, status, respStatus, res.Err.Error(), res.RetryAt)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return delivered, tx.Commit(ctx)
+}
+
+// Listing delivery history of a subscription, newest first. Empty status
+// lists every status
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, subscriptionID int64, status string, limit int) ([]WebhookDelivery, error) {
+	ctx, done := observe(ctx, "Webhook.ListDeliveries")
+	defer done()
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries d
+		WHERE d.subscription_id = $1 AND ($2 = '' OR d.status = $2)
+		ORDER BY d.id DESC
+		LIMIT $3
+	`, subscriptionID, status, limit)
+	if err != nil {
+		return nil, dbErr("webhook", err)
+	}
+	defer rows.Close()
+
+	ds := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := scanWebhookDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, rows.Err()
+}
+
+// RetryDelivery puts a dead delivery back to pending. Returns false if the
+// subscription has no dead delivery with this id
+func (r *WebhookRepository) RetryDelivery(ctx context.Context, subscriptionID, id int64) (bool, error) {
+	ctx, done := observe(ctx, "Webhook.RetryDelivery")
+	defer done()
+
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = now()
+		WHERE id = $1 AND subscription_id = $2 AND status = 'dead'
+	`, id, subscriptionID)
+	if err != nil {
+		return false, dbErr("webhook", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -2,79 +2,127 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"time"
 
-	"github.com/segmentio/kafka-go"
 	"github.com/tmozzze/order_checker/internal/cache"
+	"github.com/tmozzze/order_checker/internal/logging"
 	"github.com/tmozzze/order_checker/internal/models"
 	"github.com/tmozzze/order_checker/internal/repository"
+	"github.com/tmozzze/order_checker/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type OrderService struct {
-	repo   *repository.OrderRepository
-	cache  *cache.Cache
-	writer *kafka.Writer
+	repo        repository.OrderStore
+	cache       cache.OrderCache
+	submissions repository.SubmissionStore
+	topic       string
+	loc         *time.Location
+	log         *slog.Logger
 }
 
-func NewOrderService(repo *repository.OrderRepository, cache *cache.Cache, writer *kafka.Writer) *OrderService {
-	s := &OrderService{repo: repo, cache: cache, writer: writer}
-
-	// preload orders from Postgres
-	orders, err := repo.GetAllOrders(context.Background())
-	if err != nil {
-		log.Printf("failed to preload cache from DB: %v", err)
-	} else {
-		log.Printf("cache preloaded with %d orders", len(orders)) // Cache capacity = 100 now
-	}
-
-	return s
+func NewOrderService(repo repository.OrderStore, cache cache.OrderCache,
+	submissions repository.SubmissionStore, topic string, loc *time.Location, logger *slog.Logger) *OrderService {
+	return &OrderService{repo: repo, cache: cache, submissions: submissions, topic: topic, loc: loc,
+		log: logger.With("component", "order_service")}
 }
 
 func (s *OrderService) GetOrder(ctx context.Context, id string) (*models.Order, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "service.GetOrder",
+		trace.WithAttributes(attribute.String("order.uid", id)))
+	defer span.End()
+	ctx = logging.With(ctx, slog.String(logging.KeyOrderUID, id))
+
 	start := time.Now()
 	// Check cache
 	if val, ok := s.cache.Get(id); ok {
 		order, _ := val.(*models.Order)
-		log.Printf("[CACHE HIT] id=%s dur=%s", id, time.Since(start))
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		s.log.DebugContext(ctx, "order served from cache", "duration", time.Since(start))
 		return order, nil
 	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
 
 	// Go to Postgres
 	order, err := s.repo.GetOrderById(ctx, id)
 	if err != nil {
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 	// Set cache
 	s.cache.Set(order.OrderUID, order)
-	log.Printf("[DB FETCH] id=%s dur=%s (cached)", id, time.Since(start))
+	s.log.DebugContext(ctx, "order fetched from db and cached", "duration", time.Since(start))
 	return order, nil
 
 }
 
-func (s *OrderService) SaveOrder(ctx context.Context, order *models.Order) error {
+func (s *OrderService) ListOrders(ctx context.Context, f repository.OrderFilter) (*repository.OrderPage, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "service.ListOrders")
+	defer span.End()
+
+	page, err := s.repo.ListOrders(ctx, f)
+	tracing.RecordError(span, err)
+	return page, err
+}
+
+// SaveOrder queues the order for the consumer and returns its submission.
+// actor ends up in the order history, empty means the API itself
+func (s *OrderService) SaveOrder(ctx context.Context, order *models.Order, actor string) (*models.Submission, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "service.SaveOrder",
+		trace.WithAttributes(attribute.String("order.uid", order.OrderUID)))
+	defer span.End()
+	ctx = logging.With(ctx, slog.String(logging.KeyOrderUID, order.OrderUID))
+
 	// Date
-	loc, err := time.LoadLocation("Europe/Moscow")
-	if err != nil {
-		log.Printf("failed to load location for Date: %v", err)
-		order.DateCreated = time.Now().UTC()
-	} else {
-		order.DateCreated = time.Now().In(loc)
-	}
+	order.DateCreated = time.Now().In(s.loc)
 
 	payload, err := json.Marshal(order)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	sub := &models.Submission{
+		ID:       newSubmissionID(),
+		OrderUID: order.OrderUID,
+		Status:   models.SubmissionQueued,
+	}
+
+	// Trace context travels with the message so the consumer joins this trace
+	headers := map[string]string{models.SubmissionIDHeader: sub.ID}
+	if actor != "" {
+		headers[models.ActorHeader] = actor
 	}
+	tracing.Inject(ctx, propagation.MapCarrier(headers))
 
-	err = s.writer.WriteMessages(ctx, kafka.Message{
-		Value: payload,
+	// Written to the outbox, the relay publishes it to Kafka
+	err = s.submissions.Create(ctx, sub, &repository.OutboxMessage{
+		OrderUID: order.OrderUID,
+		Topic:    s.topic,
+		Payload:  payload,
+		Headers:  headers,
 	})
 	if err != nil {
-		log.Println("failde to write message:", err)
-		return err
+		tracing.RecordError(span, err)
+		s.log.ErrorContext(ctx, "failed to write order to outbox", "error", err)
+		return nil, err
 	}
 
-	return nil
+	s.log.InfoContext(ctx, "order queued", "submission_id", sub.ID)
+	return sub, nil
+}
+
+func (s *OrderService) GetSubmission(ctx context.Context, id string) (*models.Submission, error) {
+	return s.submissions.Get(ctx, id)
+}
+
+func newSubmissionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
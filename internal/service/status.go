@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/tmozzze/order_checker/internal/logging"
+	"github.com/tmozzze/order_checker/internal/metrics"
+	"github.com/tmozzze/order_checker/internal/models"
+	"github.com/tmozzze/order_checker/internal/repository"
+	"github.com/tmozzze/order_checker/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attempts when another update moves the order in between
+const maxStatusAttempts = 3
+
+// OrderStatusView is the current status with what may come next
+type OrderStatusView struct {
+	OrderUID string                `json:"order_uid"`
+	Status   models.OrderStatus    `json:"status"`
+	Allowed  []models.OrderStatus  `json:"allowed"`
+	History  []models.StatusChange `json:"history"`
+}
+
+// ChangeStatus applies one transition on behalf of src.Actor. Errors:
+// apperr.ErrNotFound for an unknown order, models.ErrUnknownStatus,
+// *models.IllegalTransitionError
+func (s *OrderService) ChangeStatus(ctx context.Context, orderUID string, to models.OrderStatus, src models.EventSource, reason string) (*models.StatusChange, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "service.ChangeStatus",
+		trace.WithAttributes(
+			attribute.String("order.uid", orderUID),
+			attribute.String("order.status", string(to)),
+		))
+	defer span.End()
+	ctx = logging.With(ctx, slog.String(logging.KeyOrderUID, orderUID))
+
+	change, err := s.changeStatus(ctx, orderUID, to, src, reason)
+	if err != nil {
+		tracing.RecordError(span, err)
+		result := "failed"
+		if errors.Is(err, models.ErrIllegalTransition) || errors.Is(err, models.ErrUnknownStatus) {
+			result = "rejected"
+		}
+		metrics.StatusTransitions.WithLabelValues(result).Inc()
+		s.log.WarnContext(ctx, "status change refused", "to", to, "actor", src.Actor, "error", err)
+		return nil, err
+	}
+
+	metrics.StatusTransitions.WithLabelValues("applied").Inc()
+	s.log.InfoContext(ctx, "order status changed", "from", change.From, "to", change.To, "actor", src.Actor, "source", src.Source)
+	return change, nil
+}
+
+func (s *OrderService) changeStatus(ctx context.Context, orderUID string, to models.OrderStatus, src models.EventSource, reason string) (*models.StatusChange, error) {
+	if !to.Valid() {
+		return nil, models.CheckTransition("", to)
+	}
+
+	for attempt := 1; ; attempt++ {
+		from, err := s.repo.GetOrderStatus(ctx, orderUID)
+		if err != nil {
+			return nil, err
+		}
+		if err := models.CheckTransition(from, to); err != nil {
+			return nil, err
+		}
+
+		change := &models.StatusChange{OrderUID: orderUID, From: from, To: to, Actor: src.Actor, Reason: reason}
+		err = s.repo.UpdateStatus(ctx, change, src)
+		if errors.Is(err, repository.ErrStatusChanged) && attempt < maxStatusAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// The cached order has the old status, next read reloads it
+		s.cache.Delete(orderUID)
+		return change, nil
+	}
+}
+
+func (s *OrderService) GetStatus(ctx context.Context, orderUID string) (*OrderStatusView, error) {
+	status, err := s.repo.GetOrderStatus(ctx, orderUID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.repo.ListStatusChanges(ctx, orderUID)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := status.Next()
+	if allowed == nil {
+		allowed = []models.OrderStatus{}
+	}
+	return &OrderStatusView{OrderUID: orderUID, Status: status, Allowed: allowed, History: history}, nil
+}
+
+// GetHistory is the order timeline, oldest first. apperr.ErrNotFound if the
+// order is unknown
+func (s *OrderService) GetHistory(ctx context.Context, orderUID string) ([]models.OrderEvent, error) {
+	history, err := s.repo.ListOrderEvents(ctx, orderUID)
+	if err != nil || len(history) > 0 {
+		return history, err
+	}
+
+	// Orders stored before the history existed have none
+	if _, err := s.repo.GetOrderStatus(ctx, orderUID); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
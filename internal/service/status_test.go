@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/cache"
+	"github.com/tmozzze/order_checker/internal/models"
+	"github.com/tmozzze/order_checker/internal/repository/memory"
+	"github.com/tmozzze/order_checker/internal/repository/storetest"
+)
+
+func newTestService(t *testing.T) (*OrderService, *memory.OrderStore, *cache.Cache) {
+	t.Helper()
+	store := memory.NewOrderStore()
+	c := cache.New(10)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewOrderService(store, c, nil, "orders", time.UTC, logger), store, c
+}
+
+func TestChangeStatus(t *testing.T) {
+	ctx := context.Background()
+	svc, store, c := newTestService(t)
+
+	order := storetest.Order("svc")
+	src := models.EventSource{Source: models.SourceHTTP, Actor: "support"}
+	if err := store.SaveOrder(ctx, order, src); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading caches the order with its current status
+	if _, err := svc.GetOrder(ctx, order.OrderUID); err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := svc.ChangeStatus(ctx, order.OrderUID, models.StatusPaid, src, "paid by card")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.From != models.StatusCreated || change.Actor != "support" {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	if _, ok := c.Get(order.OrderUID); ok {
+		t.Fatal("stale order left in cache")
+	}
+
+	_, err = svc.ChangeStatus(ctx, order.OrderUID, models.StatusDelivered, src, "")
+	var illegal *models.IllegalTransitionError
+	if !errors.As(err, &illegal) || illegal.From != models.StatusPaid {
+		t.Fatalf("expected illegal transition from paid, got %v", err)
+	}
+
+	if _, err := svc.ChangeStatus(ctx, order.OrderUID, "lost", src, ""); !errors.Is(err, models.ErrUnknownStatus) {
+		t.Fatalf("expected ErrUnknownStatus, got %v", err)
+	}
+	if _, err := svc.ChangeStatus(ctx, "missing", models.StatusPaid, src, ""); !errors.Is(err, apperr.ErrNotFound) {
+		t.Fatalf("expected apperr.ErrNotFound, got %v", err)
+	}
+
+	view, err := svc.GetStatus(ctx, order.OrderUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view.Status != models.StatusPaid || len(view.History) != 1 || len(view.Allowed) != 2 {
+		t.Fatalf("unexpected view %+v", view)
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	ctx := context.Background()
+	svc, store, _ := newTestService(t)
+
+	if _, err := svc.GetHistory(ctx, "missing"); !errors.Is(err, apperr.ErrNotFound) {
+		t.Fatalf("expected apperr.ErrNotFound, got %v", err)
+	}
+
+	order := storetest.Order("history")
+	if err := store.SaveOrder(ctx, order, models.EventSource{Source: models.SourceKafka}); err != nil {
+		t.Fatal(err)
+	}
+	history, err := svc.GetHistory(ctx, order.OrderUID)
+	if err != nil || len(history) != 1 || history[0].Type != models.OrderEventReceived {
+		t.Fatalf("unexpected history %+v, %v", history, err)
+	}
+}
@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/tmozzze/order_checker/internal/events"
+)
+
+var (
+	ErrSlowClient = errors.New("client too slow, reconnect with the last event id")
+	ErrClosed     = errors.New("stream closed")
+)
+
+// Client is one connected consumer of the feed
+type Client struct {
+	hub    *Hub
+	filter Filter
+	ch     chan events.Event
+	done   chan struct{}
+	err    error // set before done is closed
+	last   atomic.Uint64
+}
+
+func (c *Client) Events() <-chan events.Event { return c.ch }
+
+// Done is closed when the hub drops the client, Err tells why
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Sent records the last event written to the client
+func (c *Client) Sent(id uint64) { c.last.Store(id) }
+
+func (c *Client) lastSent() uint64 { return c.last.Load() }
+
+// Close unregisters the client, call it when the connection ends
+func (c *Client) Close() {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	c.hub.drop(c, ErrClosed)
+}
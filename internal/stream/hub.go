@@ -0,0 +1,190 @@
+// Package stream fans order events out to live clients (SSE, WebSocket)
+// and keeps the latest ones in a ring so clients can resume after a drop
+package stream
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/tmozzze/order_checker/internal/events"
+)
+
+// Event types pushed to clients, cache evictions are internal
+var streamTypes = []events.Type{events.OrderPersisted, events.OrderRejected, events.OrderDeadLettered}
+
+// Filter narrows the feed. Empty fields match everything
+type Filter struct {
+	CustomerID string
+	Provider   string
+	Status     string // persisted, rejected, dead_lettered
+}
+
+// Status is the submission status the event leads to
+func Status(t events.Type) string {
+	switch t {
+	case events.OrderPersisted:
+		return "persisted"
+	case events.OrderRejected:
+		return "rejected"
+	case events.OrderDeadLettered:
+		return "dead_lettered"
+	}
+	return ""
+}
+
+func (f Filter) Match(e events.Event) bool {
+	if f.Status != "" && f.Status != Status(e.Type) {
+		return false
+	}
+	if f.CustomerID == "" && f.Provider == "" {
+		return true
+	}
+	// Undecodable payloads carry no order and only match status filters
+	if e.Order == nil {
+		return false
+	}
+	if f.CustomerID != "" && e.Order.CustomerID != f.CustomerID {
+		return false
+	}
+	if f.Provider != "" && e.Order.Payment.Provider != f.Provider {
+		return false
+	}
+	return true
+}
+
+// Hub reads the bus and broadcasts to clients. A client whose buffer
+// fills up is disconnected instead of slowing everyone down; it can
+// reconnect with its last event ID and catch up from the ring
+type Hub struct {
+	bus          *events.Bus
+	clientBuffer int
+	log          *slog.Logger
+
+	mu      sync.Mutex
+	ring    []events.Event // oldest first once full, see start
+	start   int
+	evicted uint64 // ID of the newest event that left the ring
+	clients map[*Client]struct{}
+}
+
+func NewHub(bus *events.Bus, replaySize, clientBuffer int, logger *slog.Logger) *Hub {
+	return &Hub{
+		bus:          bus,
+		clientBuffer: clientBuffer,
+		log:          logger.With("component", "stream_hub"),
+		ring:         make([]events.Event, 0, replaySize),
+		clients:      make(map[*Client]struct{}),
+	}
+}
+
+// Run feeds the hub until ctx is cancelled or the bus is closed, then
+// disconnects every client
+func (h *Hub) Run(ctx context.Context) {
+	// Drop: the hub only copies events around, a full buffer means the
+	// process is overloaded and the ring is the least of its problems
+	sub := h.bus.Subscribe("stream", 1024, events.Drop, streamTypes...)
+	defer sub.Close()
+	defer h.closeAll()
+
+	for {
+		select {
+		case e := <-sub.Events():
+			h.broadcast(e)
+		case <-sub.Done():
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *Hub) broadcast(e events.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if cap(h.ring) > 0 {
+		if len(h.ring) < cap(h.ring) {
+			h.ring = append(h.ring, e)
+		} else {
+			h.evicted = h.ring[h.start].ID
+			h.ring[h.start] = e
+			h.start = (h.start + 1) % len(h.ring)
+		}
+	}
+
+	for c := range h.clients {
+		if !c.filter.Match(e) {
+			continue
+		}
+		select {
+		case c.ch <- e:
+		default:
+			h.log.Warn("disconnecting slow stream client", "last_event_id", c.lastSent())
+			h.drop(c, ErrSlowClient)
+		}
+	}
+}
+
+// replay returns ring events newer than lastID in order. truncated is set
+// when events after lastID have already left the ring
+func (h *Hub) replay(lastID uint64, f Filter) (out []events.Event, truncated bool) {
+	n := len(h.ring)
+	for i := 0; i < n; i++ {
+		e := h.ring[(h.start+i)%n]
+		if e.ID > lastID && f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	// IDs are shared with event types the hub skips, so gaps between
+	// them mean nothing. Only events pushed out of the ring are lost
+	return out, lastID < h.evicted
+}
+
+// Subscribe registers a client. With lastID > 0 the ring events after it
+// are queued first; truncated reports that some could not be replayed
+func (h *Hub) Subscribe(lastID uint64, f Filter) (c *Client, truncated bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var backlog []events.Event
+	if lastID > 0 {
+		backlog, truncated = h.replay(lastID, f)
+	}
+
+	c = &Client{
+		hub:    h,
+		filter: f,
+		ch:     make(chan events.Event, max(h.clientBuffer, len(backlog))),
+		done:   make(chan struct{}),
+	}
+	for _, e := range backlog {
+		c.ch <- e
+	}
+	h.clients[c] = struct{}{}
+	return c, truncated
+}
+
+func (h *Hub) drop(c *Client, err error) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	c.err = err
+	close(c.done)
+}
+
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		h.drop(c, ErrClosed)
+	}
+}
+
+// Clients is the number of connected clients
+func (h *Hub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
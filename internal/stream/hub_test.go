@@ -0,0 +1,134 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/events"
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+func newTestHub(t *testing.T, replay, buffer int) (*Hub, *events.Bus) {
+	t.Helper()
+	bus := events.NewBus()
+	hub := NewHub(bus, replay, buffer, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+
+	// Run subscribes asynchronously, wait until it sees events
+	probe, _ := hub.Subscribe(0, Filter{})
+	defer probe.Close()
+	deadline := time.After(time.Second)
+	for {
+		bus.Publish(ctx, events.Event{Type: events.OrderRejected, OrderUID: "probe"})
+		select {
+		case <-probe.Events():
+			return hub, bus
+		case <-deadline:
+			t.Fatal("hub did not start")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func persisted(uid, customer string) events.Event {
+	return events.Event{
+		Type:     events.OrderPersisted,
+		OrderUID: uid,
+		Order:    &models.Order{OrderUID: uid, CustomerID: customer},
+	}
+}
+
+func next(t *testing.T, c *Client) events.Event {
+	t.Helper()
+	select {
+	case e := <-c.Events():
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return events.Event{}
+}
+
+func TestReplayFromLastEventID(t *testing.T) {
+	hub, bus := newTestHub(t, 3, 8)
+	ctx := context.Background()
+
+	live, _ := hub.Subscribe(0, Filter{})
+	defer live.Close()
+
+	var ids []uint64
+	for _, uid := range []string{"o-1", "o-2", "o-3", "o-4"} {
+		bus.Publish(ctx, persisted(uid, "c-1"))
+		ids = append(ids, next(t, live).ID)
+	}
+
+	// o-2 is still in the ring of three: resume after it
+	c, truncated := hub.Subscribe(ids[1], Filter{})
+	defer c.Close()
+	if truncated {
+		t.Fatal("replay from a buffered event must not be truncated")
+	}
+	if e := next(t, c); e.OrderUID != "o-3" {
+		t.Fatalf("expected o-3, got %s", e.OrderUID)
+	}
+	if e := next(t, c); e.OrderUID != "o-4" {
+		t.Fatalf("expected o-4, got %s", e.OrderUID)
+	}
+
+	// o-1 and the probe have left the ring
+	old, truncated := hub.Subscribe(ids[0]-1, Filter{})
+	defer old.Close()
+	if !truncated {
+		t.Fatal("expected truncated replay")
+	}
+}
+
+func TestSlowClientIsDropped(t *testing.T) {
+	hub, bus := newTestHub(t, 10, 1)
+	ctx := context.Background()
+
+	slow, _ := hub.Subscribe(0, Filter{})
+	bus.Publish(ctx, persisted("o-1", "c-1"))
+	bus.Publish(ctx, persisted("o-2", "c-1"))
+
+	select {
+	case <-slow.Done():
+	case <-time.After(time.Second):
+		t.Fatal("slow client was not dropped")
+	}
+	if !errors.Is(slow.Err(), ErrSlowClient) {
+		t.Fatalf("expected ErrSlowClient, got %v", slow.Err())
+	}
+}
+
+func TestFilter(t *testing.T) {
+	e := persisted("o-1", "c-1")
+	e.Order.Payment.Provider = "wbpay"
+
+	cases := []struct {
+		f    Filter
+		want bool
+	}{
+		{Filter{}, true},
+		{Filter{CustomerID: "c-1", Provider: "wbpay", Status: "persisted"}, true},
+		{Filter{CustomerID: "c-2"}, false},
+		{Filter{Status: "rejected"}, false},
+	}
+	for _, tc := range cases {
+		if got := tc.f.Match(e); got != tc.want {
+			t.Errorf("%+v: got %v, want %v", tc.f, got, tc.want)
+		}
+	}
+
+	undecoded := events.Event{Type: events.OrderRejected}
+	if (Filter{CustomerID: "c-1"}).Match(undecoded) {
+		t.Error("event without an order must not match an order filter")
+	}
+}
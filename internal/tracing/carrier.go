@@ -0,0 +1,35 @@
+package tracing
+
+import "github.com/segmentio/kafka-go"
+
+// KafkaHeaders adapts Kafka message headers to a propagation carrier
+type KafkaHeaders struct {
+	Headers *[]kafka.Header
+}
+
+func (c KafkaHeaders) Get(key string) string {
+	for _, h := range *c.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c KafkaHeaders) Set(key, value string) {
+	for i, h := range *c.Headers {
+		if h.Key == key {
+			(*c.Headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.Headers = append(*c.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c KafkaHeaders) Keys() []string {
+	keys := make([]string, 0, len(*c.Headers))
+	for _, h := range *c.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
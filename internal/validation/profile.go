@@ -0,0 +1,194 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/tmozzze/order_checker/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// StrictName is the built-in profile used when nothing else matches
+const StrictName = "strict"
+
+// DefaultRequired is the required list of a profile that sets none
+var DefaultRequired = []string{
+	"order_uid", "track_number", "customer_id", "delivery.name",
+	"payment.transaction", "payment.currency",
+}
+
+// Strict requires DefaultRequired and treats every violation as an error
+var Strict = &Profile{Name: StrictName}
+
+// Profile is the strictness for one upstream
+type Profile struct {
+	Name string `yaml:"-"`
+	// Field paths that must be set, zero numbers count as missing.
+	// DefaultRequired when empty. order_uid is required regardless
+	Required []string `yaml:"required"`
+	// Rules reported as warnings, the order is stored with them
+	Warn []string `yaml:"warn"`
+	// Allowed difference per sum rule, in payment units
+	Tolerance map[string]int `yaml:"tolerance"`
+}
+
+func (p *Profile) required() []string {
+	if len(p.Required) == 0 {
+		return DefaultRequired
+	}
+	return p.Required
+}
+
+func (p *Profile) warns(rule string) bool {
+	return slices.Contains(p.Warn, rule)
+}
+
+func (p *Profile) check() []error {
+	var errs []error
+	for _, f := range p.Required {
+		if _, ok := requiredFields[f]; !ok {
+			errs = append(errs, fmt.Errorf("profile %s: unknown required field %q", p.Name, f))
+		}
+	}
+	for _, r := range p.Warn {
+		if !slices.Contains(rules, r) {
+			errs = append(errs, fmt.Errorf("profile %s: unknown rule %q in warn", p.Name, r))
+		}
+	}
+	for r, n := range p.Tolerance {
+		if !slices.Contains(sumRules, r) {
+			errs = append(errs, fmt.Errorf("profile %s: tolerance for %q, only %v have one", p.Name, r, sumRules))
+		}
+		if n < 0 {
+			errs = append(errs, fmt.Errorf("profile %s: tolerance for %q must not be negative", p.Name, r))
+		}
+	}
+	return errs
+}
+
+// Profiles maps upstreams to profiles. An order is checked with the
+// profile of its entry, else of the Kafka topic it came from, else with
+// the default one
+type Profiles struct {
+	Default  string              `yaml:"default"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+	Entries  map[string]string   `yaml:"entries"`
+	Topics   map[string]string   `yaml:"topics"`
+}
+
+// LoadProfiles reads profiles from a YAML file. An empty path gives only
+// the Strict profile
+func LoadProfiles(path string) (*Profiles, error) {
+	ps := &Profiles{}
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("validation profiles: %w", err)
+		}
+		defer f.Close()
+
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err := dec.Decode(ps); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("validation profiles %s: %w", path, err)
+		}
+	}
+	if err := ps.init(); err != nil {
+		return nil, fmt.Errorf("validation profiles %s: %w", path, err)
+	}
+	return ps, nil
+}
+
+// init fills in the built-in profile and checks references
+func (ps *Profiles) init() error {
+	if ps.Profiles == nil {
+		ps.Profiles = make(map[string]*Profile)
+	}
+	if _, ok := ps.Profiles[StrictName]; !ok {
+		ps.Profiles[StrictName] = Strict
+	}
+	if ps.Default == "" {
+		ps.Default = StrictName
+	}
+
+	var errs []error
+	names := make([]string, 0, len(ps.Profiles))
+	for name := range ps.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := ps.Profiles[name]
+		if p == nil {
+			p = &Profile{}
+			ps.Profiles[name] = p
+		}
+		p.Name = name
+		errs = append(errs, p.check()...)
+	}
+
+	ref := func(what, name string) {
+		if _, ok := ps.Profiles[name]; !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown profile %q", what, name))
+		}
+	}
+	ref("default", ps.Default)
+	for entry, name := range ps.Entries {
+		ref("entry "+entry, name)
+	}
+	for topic, name := range ps.Topics {
+		ref("topic "+topic, name)
+	}
+	return errors.Join(errs...)
+}
+
+// Select returns the profile for an order with entry read from topic.
+// topic is empty for orders that did not come from Kafka
+func (ps *Profiles) Select(entry, topic string) *Profile {
+	if name, ok := ps.Entries[entry]; ok && entry != "" {
+		return ps.Profiles[name]
+	}
+	if name, ok := ps.Topics[topic]; ok && topic != "" {
+		return ps.Profiles[name]
+	}
+	return ps.Profiles[ps.Default]
+}
+
+// requiredFields reports whether a field a profile may require is set
+var requiredFields = map[string]func(o *models.Order) bool{
+	"order_uid":          func(o *models.Order) bool { return o.OrderUID != "" },
+	"track_number":       func(o *models.Order) bool { return o.TrackNumber != "" },
+	"entry":              func(o *models.Order) bool { return o.Entry != "" },
+	"locale":             func(o *models.Order) bool { return o.Locale != "" },
+	"internal_signature": func(o *models.Order) bool { return o.InternalSignature != "" },
+	"customer_id":        func(o *models.Order) bool { return o.CustomerID != "" },
+	"delivery_service":   func(o *models.Order) bool { return o.DeliveryService != "" },
+	"shardkey":           func(o *models.Order) bool { return o.ShardKey != "" },
+	"sm_id":              func(o *models.Order) bool { return o.SmID != 0 },
+	"date_created":       func(o *models.Order) bool { return !o.DateCreated.IsZero() },
+	"oof_shard":          func(o *models.Order) bool { return o.OofShard != "" },
+	"items":              func(o *models.Order) bool { return len(o.Items) > 0 },
+
+	"delivery.name":    func(o *models.Order) bool { return o.Delivery.Name != "" },
+	"delivery.phone":   func(o *models.Order) bool { return o.Delivery.Phone != "" },
+	"delivery.zip":     func(o *models.Order) bool { return o.Delivery.Zip != "" },
+	"delivery.city":    func(o *models.Order) bool { return o.Delivery.City != "" },
+	"delivery.address": func(o *models.Order) bool { return o.Delivery.Address != "" },
+	"delivery.region":  func(o *models.Order) bool { return o.Delivery.Region != "" },
+	"delivery.email":   func(o *models.Order) bool { return o.Delivery.Email != "" },
+
+	"payment.transaction":   func(o *models.Order) bool { return o.Payment.Transaction != "" },
+	"payment.request_id":    func(o *models.Order) bool { return o.Payment.RequestID != "" },
+	"payment.currency":      func(o *models.Order) bool { return o.Payment.Currency != "" },
+	"payment.provider":      func(o *models.Order) bool { return o.Payment.Provider != "" },
+	"payment.amount":        func(o *models.Order) bool { return o.Payment.Amount != 0 },
+	"payment.payment_dt":    func(o *models.Order) bool { return o.Payment.PaymentDt != 0 },
+	"payment.bank":          func(o *models.Order) bool { return o.Payment.Bank != "" },
+	"payment.delivery_cost": func(o *models.Order) bool { return o.Payment.DeliveryCost != 0 },
+	"payment.goods_total":   func(o *models.Order) bool { return o.Payment.GoodsTotal != 0 },
+	"payment.custom_fee":    func(o *models.Order) bool { return o.Payment.CustomFee != 0 },
+}
@@ -0,0 +1,135 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const profilesYAML = `
+default: wb
+profiles:
+  wb:
+    required: [order_uid, track_number, customer_id, delivery.name, payment.transaction, payment.currency, payment.request_id, sm_id]
+  legacy:
+    warn: [phone, item_track_number]
+    tolerance:
+      amount_sum: 5
+entries:
+  OLD: legacy
+topics:
+  orders.legacy: legacy
+`
+
+func loadProfiles(t *testing.T, data string) (*Profiles, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadProfiles(path)
+}
+
+func TestSelect(t *testing.T) {
+	ps, err := loadProfiles(t, profilesYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct{ entry, topic, want string }{
+		{"OLD", "orders", "legacy"},
+		{"WBIL", "orders.legacy", "legacy"},
+		{"WBIL", "orders", "wb"},
+		{"", "", "wb"},
+	}
+	for _, tc := range cases {
+		if got := ps.Select(tc.entry, tc.topic).Name; got != tc.want {
+			t.Errorf("Select(%q, %q) = %s, want %s", tc.entry, tc.topic, got, tc.want)
+		}
+	}
+	if ps.Profiles[StrictName] != Strict {
+		t.Error("built-in strict profile missing")
+	}
+}
+
+func TestProfileCheck(t *testing.T) {
+	ps, err := loadProfiles(t, profilesYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wb requires request_id and sm_id, the test order has neither
+	res := ps.Profiles["wb"].Check(validOrder())
+	if len(res.Errors) != 2 || res.Errors[0].Field != "payment.request_id" || res.Errors[1].Field != "sm_id" {
+		t.Fatalf("unexpected errors %+v", res.Errors)
+	}
+
+	// legacy lets a bad phone through and the amount be a bit off
+	o := validOrder()
+	o.Delivery.Phone = "8 972 000 00 00"
+	o.Payment.Amount += 5
+	res = ps.Profiles["legacy"].Check(o)
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 1 || res.Warnings[0].Rule != RulePhone {
+		t.Fatalf("unexpected warnings %+v", res.Warnings)
+	}
+	if r := res.Report(); r.Profile != "legacy" || len(r.Warnings) != 1 {
+		t.Fatalf("unexpected report %+v", r)
+	}
+
+	o.Payment.Amount++
+	if err := ps.Profiles["legacy"].Check(o).Err(); err == nil {
+		t.Fatal("amount beyond tolerance accepted")
+	}
+
+	// order_uid can't be waived
+	o = validOrder()
+	o.OrderUID = ""
+	lax := &Profile{Name: "lax", Required: []string{"track_number"}, Warn: []string{RuleRequired}}
+	if err := lax.Check(o).Err(); err == nil {
+		t.Fatal("order without order_uid accepted")
+	}
+}
+
+func TestLoadProfilesErrors(t *testing.T) {
+	_, err := loadProfiles(t, `
+default: missing
+profiles:
+  bad:
+    required: [payment.colour]
+    warn: [spelling]
+    tolerance: {phone: 1, amount_sum: -1}
+entries:
+  X: nowhere
+`)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{`"payment.colour"`, `"spelling"`, `tolerance for "phone"`, "must not be negative", `default: unknown profile "missing"`, `entry X: unknown profile "nowhere"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s:\n%v", want, err)
+		}
+	}
+
+	if _, err := loadProfiles(t, "profiles:\n  a:\n    requird: [x]\n"); err == nil {
+		t.Fatal("unknown keys accepted")
+	}
+
+	ps, err := LoadProfiles("")
+	if err != nil || ps.Select("WBIL", "orders") != Strict {
+		t.Fatalf("empty path: %v", err)
+	}
+}
+
+func TestExampleProfiles(t *testing.T) {
+	ps, err := LoadProfiles("../../validation.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps.Select("LEGACY", "").Name != "legacy" {
+		t.Fatal("LEGACY entry is not mapped to legacy")
+	}
+}
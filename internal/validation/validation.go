@@ -0,0 +1,181 @@
+// Package validation checks orders before they are stored. It reports
+// every violation at once, each with the JSON path of the field and the
+// rule that failed. A Profile decides which fields are required, which
+// rules only warn and how far sums may be off
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+// Rules, the names profiles refer to
+const (
+	RuleRequired        = "required"
+	RuleLocale          = "locale"
+	RulePhone           = "phone"
+	RuleEmail           = "email"
+	RuleCurrency        = "currency"
+	RuleNonNegative     = "non_negative"
+	RuleSale            = "sale"
+	RuleAmountSum       = "amount_sum"        // amount = goods_total + delivery_cost + custom_fee
+	RuleGoodsTotalSum   = "goods_total_sum"   // goods_total = sum of items total_price
+	RuleItemTotal       = "item_total"        // total_price = price with sale applied
+	RuleItemTrackNumber = "item_track_number" // items share the order track_number
+)
+
+var rules = []string{
+	RuleRequired, RuleLocale, RulePhone, RuleEmail, RuleCurrency, RuleNonNegative,
+	RuleSale, RuleAmountSum, RuleGoodsTotalSum, RuleItemTotal, RuleItemTrackNumber,
+}
+
+// Rules a tolerance can be set for
+var sumRules = []string{RuleAmountSum, RuleGoodsTotalSum, RuleItemTotal}
+
+// E.164: a plus, a non-zero country digit, at most 15 digits in total
+var phoneRe = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// Result of checking one order. Warnings do not reject the order
+type Result struct {
+	Profile  string
+	Errors   []apperr.FieldError
+	Warnings []apperr.FieldError
+}
+
+// Err returns an apperr.ErrValidation error listing the errors, or nil
+func (r *Result) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return apperr.Validation("invalid order", r.Errors...)
+}
+
+// Report is what gets stored with the order
+func (r *Result) Report() *models.ValidationReport {
+	return &models.ValidationReport{Profile: r.Profile, Warnings: r.Warnings}
+}
+
+// Check runs every rule of p against o. Violations come in field order
+func (p *Profile) Check(o *models.Order) *Result {
+	c := checker{profile: p, result: &Result{Profile: p.Name}}
+
+	// Without order_uid the order can't be stored, no profile waives it
+	if o.OrderUID == "" {
+		c.result.Errors = append(c.result.Errors, apperr.FieldError{Field: "order_uid", Message: "is required", Rule: RuleRequired})
+	}
+	for _, field := range p.required() {
+		if field != "order_uid" && !requiredFields[field](o) {
+			c.add(RuleRequired, field, "is required")
+		}
+	}
+
+	if o.Locale != "" && !isLocale(o.Locale) {
+		c.add(RuleLocale, "locale", "must be an ISO 639-1 language with an optional ISO 3166 region, like en or en-US")
+	}
+
+	d := o.Delivery
+	if d.Phone != "" && !phoneRe.MatchString(d.Phone) {
+		c.add(RulePhone, "delivery.phone", "must be an E.164 number, like +79720000000")
+	}
+	if d.Email != "" && !isEmail(d.Email) {
+		c.add(RuleEmail, "delivery.email", "must be an email address")
+	}
+
+	pm := o.Payment
+	if pm.Currency != "" && !isCurrency(pm.Currency) {
+		c.add(RuleCurrency, "payment.currency", "must be an ISO 4217 currency code")
+	}
+	c.nonNegative("payment.amount", pm.Amount)
+	c.nonNegative("payment.delivery_cost", pm.DeliveryCost)
+	c.nonNegative("payment.goods_total", pm.GoodsTotal)
+	c.nonNegative("payment.custom_fee", pm.CustomFee)
+	if sum := pm.GoodsTotal + pm.DeliveryCost + pm.CustomFee; c.differs(RuleAmountSum, pm.Amount, sum) {
+		c.add(RuleAmountSum, "payment.amount", fmt.Sprintf("must equal goods_total + delivery_cost + custom_fee (%d)", sum))
+	}
+
+	var itemsTotal int
+	for i := range o.Items {
+		item := &o.Items[i]
+		path := fmt.Sprintf("items[%d]", i)
+		itemsTotal += item.TotalPrice
+
+		c.nonNegative(path+".price", item.Price)
+		c.nonNegative(path+".total_price", item.TotalPrice)
+		if item.Sale < 0 || item.Sale > 100 {
+			c.add(RuleSale, path+".sale", "must be between 0 and 100")
+		} else if want := item.CalculateTotalPrice(); c.differs(RuleItemTotal, item.TotalPrice, want) {
+			c.add(RuleItemTotal, path+".total_price", fmt.Sprintf("must equal price with sale applied (%d)", want))
+		}
+		if item.TrackNumber != o.TrackNumber {
+			c.add(RuleItemTrackNumber, path+".track_number", "must match the order track_number")
+		}
+	}
+	if c.differs(RuleGoodsTotalSum, pm.GoodsTotal, itemsTotal) {
+		c.add(RuleGoodsTotalSum, "payment.goods_total", fmt.Sprintf("must equal the sum of items total_price (%d)", itemsTotal))
+	}
+
+	return c.result
+}
+
+type checker struct {
+	profile *Profile
+	result  *Result
+}
+
+func (c *checker) add(rule, field, message string) {
+	e := apperr.FieldError{Field: field, Message: message, Rule: rule}
+	if c.profile.warns(rule) {
+		c.result.Warnings = append(c.result.Warnings, e)
+		return
+	}
+	c.result.Errors = append(c.result.Errors, e)
+}
+
+func (c *checker) nonNegative(field string, value int) {
+	if value < 0 {
+		c.add(RuleNonNegative, field, "must not be negative")
+	}
+}
+
+// differs reports whether got is further from want than the rule allows
+func (c *checker) differs(rule string, got, want int) bool {
+	diff := got - want
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff > c.profile.Tolerance[rule]
+}
+
+// isEmail accepts a bare address, without a display name
+func isEmail(s string) bool {
+	a, err := mail.ParseAddress(s)
+	return err == nil && a.Address == s
+}
+
+func isCurrency(s string) bool {
+	_, ok := currencies[s]
+	return ok
+}
+
+// isLocale accepts "ll" or "ll-RR" (also "ll_RR")
+func isLocale(s string) bool {
+	lang, region, hasRegion := strings.Cut(strings.ReplaceAll(s, "_", "-"), "-")
+	if _, ok := languages[lang]; !ok {
+		return false
+	}
+	return !hasRegion || (len(region) == 2 && isUpperLetters(region))
+}
+
+func isUpperLetters(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tmozzze/order_checker/internal/apperr"
+	"github.com/tmozzze/order_checker/internal/models"
+)
+
+// validOrder passes Strict. It has no payment.request_id and no sm_id
+func validOrder() *models.Order {
+	return &models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Locale:      "en",
+		CustomerID:  "test",
+		Delivery:    models.Delivery{Name: "Test Testov", Phone: "+79720000000", Email: "test@gmail.com"},
+		Payment: models.Payment{
+			Transaction: "b563feb7b2b84b6test", Currency: "USD",
+			Amount: 110, DeliveryCost: 10, GoodsTotal: 100,
+		},
+		Items: []models.Item{{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 100, TotalPrice: 100}},
+	}
+}
+
+func TestStrictValid(t *testing.T) {
+	if err := Strict.Check(validOrder()).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	o := validOrder()
+	o.Locale = "en-US"
+	o.Items[0].Sale = 30
+	o.Items[0].TotalPrice = 70
+	o.Payment.GoodsTotal, o.Payment.CustomFee, o.Payment.Amount = 70, 5, 85
+	if err := Strict.Check(o).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrictReportsEveryField(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(o *models.Order)
+		want   []string
+	}{
+		{"required", func(o *models.Order) { o.OrderUID, o.Delivery.Name = "", "" }, []string{"order_uid", "delivery.name"}},
+		{"currency", func(o *models.Order) { o.Payment.Currency = "usd" }, []string{"payment.currency"}},
+		{"locale", func(o *models.Order) { o.Locale = "english" }, []string{"locale"}},
+		{"phone", func(o *models.Order) { o.Delivery.Phone = "89720000000" }, []string{"delivery.phone"}},
+		{"email", func(o *models.Order) { o.Delivery.Email = "Test <test@example.com>" }, []string{"delivery.email"}},
+		{"negative", func(o *models.Order) {
+			o.Payment.DeliveryCost, o.Payment.Amount = -10, 90
+		}, []string{"payment.delivery_cost"}},
+		{"amount", func(o *models.Order) { o.Payment.Amount++ }, []string{"payment.amount"}},
+		{"goods total", func(o *models.Order) {
+			o.Items = append(o.Items, o.Items[0])
+		}, []string{"payment.goods_total"}},
+		{"item total", func(o *models.Order) {
+			o.Items[0].Sale = 10
+		}, []string{"items[0].total_price"}},
+		{"item track number", func(o *models.Order) {
+			o.Items = append(o.Items, o.Items[0], o.Items[0])
+			o.Items[2].TrackNumber = "other"
+			o.Payment.GoodsTotal, o.Payment.Amount = 300, 310
+		}, []string{"items[2].track_number"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := validOrder()
+			tc.change(o)
+
+			err := Strict.Check(o).Err()
+			if !errors.Is(err, apperr.ErrValidation) {
+				t.Fatalf("expected apperr.ErrValidation, got %v", err)
+			}
+			var got []string
+			for _, f := range apperr.Fields(err) {
+				got = append(got, f.Field)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("fields %v, want %v (%v)", got, tc.want, err)
+			}
+		})
+	}
+}
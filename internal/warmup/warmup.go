@@ -0,0 +1,127 @@
+package warmup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/cache"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+// Warmer preloads the most recent orders from Postgres into the cache
+type Warmer struct {
+	repo      repository.OrderStore
+	cache     cache.OrderCache
+	batchSize int
+	timeout   time.Duration
+	log       *slog.Logger
+
+	loaded atomic.Int64
+	done   chan struct{}
+	once   sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+func New(repo repository.OrderStore, c cache.OrderCache, batchSize int, timeout time.Duration, logger *slog.Logger) *Warmer {
+	if batchSize <= 0 {
+		batchSize = c.Capacity()
+	}
+	return &Warmer{
+		repo:      repo,
+		cache:     c,
+		batchSize: batchSize,
+		timeout:   timeout,
+		log:       logger.With("component", "cache_warmup"),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start runs warm-up in background. Done() is closed when it finishes or times out
+func (w *Warmer) Start(ctx context.Context) {
+	go w.run(ctx)
+}
+
+func (w *Warmer) run(ctx context.Context) {
+	defer w.once.Do(func() { close(w.done) })
+
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	target := w.cache.Capacity()
+	w.log.InfoContext(ctx, "cache warm-up started", "target", target, "batch", w.batchSize)
+
+	offset := 0
+	for offset < target {
+		limit := min(w.batchSize, target-offset)
+
+		orders, err := w.repo.GetRecentOrders(ctx, limit, offset)
+		if err != nil {
+			w.setErr(err)
+			w.log.ErrorContext(ctx, "cache warm-up stopped", "loaded", w.loaded.Load(), "target", target, "error", err)
+			return
+		}
+
+		w.loaded.Add(int64(w.cache.LoadAll(orders)))
+		offset += len(orders)
+		w.log.DebugContext(ctx, "cache warm-up progress", "loaded", w.loaded.Load(), "target", target)
+
+		// Fewer rows than asked: table is exhausted
+		if len(orders) < limit {
+			break
+		}
+	}
+
+	w.log.InfoContext(ctx, "cache warm-up finished", "loaded", w.loaded.Load(), "duration", time.Since(start))
+}
+
+func (w *Warmer) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+}
+
+// Done is closed once warm-up has finished, failed or timed out
+func (w *Warmer) Done() <-chan struct{} {
+	return w.done
+}
+
+// Ready reports whether the readiness gate is open
+func (w *Warmer) Ready() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Check is a readiness check: fails until warm-up is done
+func (w *Warmer) Check(ctx context.Context) error {
+	if !w.Ready() {
+		loaded, target := w.Progress()
+		return fmt.Errorf("cache warming up: %d/%d", loaded, target)
+	}
+	return nil
+}
+
+// Progress returns loaded orders and the target (cache capacity)
+func (w *Warmer) Progress() (loaded, target int) {
+	return int(w.loaded.Load()), w.cache.Capacity()
+}
+
+// Err returns the error that stopped warm-up, if any
+func (w *Warmer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/events"
+	"github.com/tmozzze/order_checker/internal/logging"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+// Event types a subscription can ask for
+var EventTypes = []events.Type{events.OrderPersisted, events.OrderRejected, events.OrderDeadLettered}
+
+// Envelope is the request body of every webhook
+type Envelope struct {
+	ID        string       `json:"id"`
+	Type      events.Type  `json:"type"`
+	CreatedAt time.Time    `json:"created_at"`
+	Data      events.Event `json:"data"`
+}
+
+// Dispatcher turns bus events into pending deliveries. Sending is left to
+// Sender so a slow receiver never holds up the bus
+type Dispatcher struct {
+	repo *repository.WebhookRepository
+	bus  *events.Bus
+	log  *slog.Logger
+}
+
+func NewDispatcher(repo *repository.WebhookRepository, bus *events.Bus, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{repo: repo, bus: bus, log: logger.With("component", "webhook_dispatcher")}
+}
+
+// Run enqueues deliveries until ctx is cancelled or the bus is closed
+func (d *Dispatcher) Run(ctx context.Context) {
+	// Block: an event missed here is a notification lost for good
+	sub := d.bus.Subscribe("webhooks", 256, events.Block, EventTypes...)
+	defer sub.Close()
+
+	for {
+		select {
+		case e := <-sub.Events():
+			d.enqueue(ctx, e)
+		case <-sub.Done():
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, e events.Event) {
+	ctx = logging.With(ctx, slog.String(logging.KeyOrderUID, e.OrderUID))
+
+	env := Envelope{ID: newEventID(), Type: e.Type, CreatedAt: e.At, Data: e}
+	payload, err := json.Marshal(env)
+	if err != nil {
+		d.log.ErrorContext(ctx, "failed to encode webhook event", "type", e.Type, "error", err)
+		return
+	}
+
+	n, err := d.repo.Enqueue(ctx, env.ID, string(e.Type), e.OrderUID, payload)
+	if err != nil {
+		d.log.ErrorContext(ctx, "failed to enqueue webhook deliveries", "type", e.Type, "error", err)
+		return
+	}
+	if n > 0 {
+		d.log.DebugContext(ctx, "webhook deliveries enqueued", "type", e.Type, "deliveries", n)
+	}
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
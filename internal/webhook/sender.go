@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tmozzze/order_checker/internal/logging"
+	"github.com/tmozzze/order_checker/internal/metrics"
+	"github.com/tmozzze/order_checker/internal/repository"
+)
+
+type Config struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+	Timeout      time.Duration // per request
+	RetryInitial time.Duration
+	RetryMax     time.Duration
+}
+
+// Sender posts due deliveries and records the outcome. Failed deliveries
+// are retried with exponential backoff and marked dead after MaxAttempts
+type Sender struct {
+	repo   *repository.WebhookRepository
+	client *http.Client
+	cfg    Config
+	log    *slog.Logger
+}
+
+func NewSender(repo *repository.WebhookRepository, cfg Config, logger *slog.Logger) *Sender {
+	return &Sender{
+		repo:   repo,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+		log:    logger.With("component", "webhook_sender"),
+	}
+}
+
+// Run polls for due deliveries until ctx is cancelled
+func (s *Sender) Run(ctx context.Context) {
+	s.log.InfoContext(ctx, "webhook sender started")
+
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain everything that is due before waiting for the next tick
+		for {
+			n, err := s.repo.ProcessDue(ctx, s.cfg.BatchSize, s.deliver)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.log.ErrorContext(ctx, "webhook sender error", "error", err)
+				}
+				break
+			}
+			if n < s.cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			s.log.InfoContext(ctx, "webhook sender stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver sends a batch in parallel, one receiver being slow only costs
+// its own request timeout
+func (s *Sender) deliver(ctx context.Context, ds []repository.WebhookDelivery) []repository.DeliveryResult {
+	results := make([]repository.DeliveryResult, len(ds))
+	var wg sync.WaitGroup
+	for i := range ds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = s.send(ctx, ds[i])
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (s *Sender) send(ctx context.Context, d repository.WebhookDelivery) repository.DeliveryResult {
+	ctx = logging.With(ctx, slog.String(logging.KeyOrderUID, d.OrderUID))
+
+	status, err := s.post(ctx, d)
+	if err == nil {
+		metrics.WebhookDeliveries.WithLabelValues(repository.WebhookDelivered).Inc()
+		return repository.DeliveryResult{ResponseStatus: status}
+	}
+
+	attempts := d.Attempts + 1
+	res := repository.DeliveryResult{
+		Err:            err,
+		ResponseStatus: status,
+		RetryAt:        time.Now().Add(s.backoff(attempts)),
+		GiveUp:         attempts >= s.cfg.MaxAttempts,
+	}
+
+	outcome := "retry"
+	if res.GiveUp {
+		outcome = repository.WebhookDead
+	}
+	metrics.WebhookDeliveries.WithLabelValues(outcome).Inc()
+	s.log.WarnContext(ctx, "webhook delivery failed",
+		"delivery_id", d.ID,
+		"subscription_id", d.SubscriptionID,
+		"attempt", attempts,
+		"give_up", res.GiveUp,
+		"error", err,
+	)
+	return res
+}
+
+// post returns the response status, non 2xx answers are errors
+func (s *Sender) post(ctx context.Context, d repository.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, d.EventID)
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, now, d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Keep a bit of the body for the delivery history
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff doubles from RetryInitial up to RetryMax
+func (s *Sender) backoff(attempt int) time.Duration {
+	d := s.cfg.RetryInitial << min(attempt-1, 30)
+	if d <= 0 || d > s.cfg.RetryMax {
+		return s.cfg.RetryMax
+	}
+	return d
+}
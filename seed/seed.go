@@ -32,11 +32,9 @@ func main() {
 				Transaction:  fmt.Sprintf("txn-%d", i),
 				Currency:     "USD",
 				Provider:     "visa",
-				Amount:       rand.Intn(5000) + 100,
 				PaymentDt:    time.Now().Unix(),
 				Bank:         "Hapoalim",
 				DeliveryCost: 500,
-				GoodsTotal:   rand.Intn(4000) + 500,
 				CustomFee:    0,
 			},
 			Items: []models.Item{
@@ -54,9 +52,14 @@ func main() {
 				},
 			},
 		}
-		for _, item := range order.Items {
-			item.CalculateTotalPrice()
+		// Totals have to add up, the service rejects the order otherwise
+		for i := range order.Items {
+			item := &order.Items[i]
+			item.TotalPrice = item.CalculateTotalPrice()
+			order.Payment.GoodsTotal += item.TotalPrice
 		}
+		p := &order.Payment
+		p.Amount = p.GoodsTotal + p.DeliveryCost + p.CustomFee
 
 		body, _ := json.Marshal(order)
 
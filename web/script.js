@@ -116,6 +116,42 @@ document.addEventListener('DOMContentLoaded', function() {
     `;
   }
 
+  // Живой поток заказов через SSE, браузер сам переподключается с Last-Event-ID
+  const feed = document.getElementById('feed');
+  const feedStatus = document.getElementById('feedStatus');
+  const feedLimit = 50;
+  const statusText = {
+    'order.persisted': 'сохранен',
+    'order.rejected': 'отклонен',
+    'order.dead_lettered': 'в DLQ'
+  };
+
+  const source = new EventSource('/orders/stream');
+  source.onopen = () => { feedStatus.textContent = 'онлайн'; };
+  source.onerror = () => { feedStatus.textContent = 'переподключение...'; };
+
+  Object.keys(statusText).forEach(type => {
+    source.addEventListener(type, e => addFeedItem(JSON.parse(e.data)));
+  });
+
+  function addFeedItem(event) {
+    const li = document.createElement('li');
+    li.className = event.type.replace('.', '-');
+    const time = new Date(event.at).toLocaleTimeString('ru-RU');
+    li.textContent = `${time} ${event.order_uid || '—'}: ${statusText[event.type]}` +
+      (event.reason ? ` (${event.reason})` : '');
+    if (event.order_uid) {
+      li.addEventListener('click', () => {
+        orderIdInput.value = event.order_uid;
+        handleSearch();
+      });
+    }
+    feed.prepend(li);
+    while (feed.children.length > feedLimit) {
+      feed.lastChild.remove();
+    }
+  }
+
   function showLoading() {
     resultDiv.innerHTML = '<div class="loading">Поиск заказа...</div>';
   }